@@ -2,6 +2,12 @@ package api
 
 import "time"
 
+// Content types accepted by the submit API
+const (
+	ContentTypeJSON  = "application/json"
+	ContentTypeProto = "application/x-protobuf"
+)
+
 type Transport string
 
 const (
@@ -27,6 +33,9 @@ type Metrics struct {
 	CountGood    int64 `json:"count_good"`
 	CountWarning int64 `json:"count_warning"`
 	CountBad     int64 `json:"count_bad"`
+
+	// Latency is optional, only calls which were timed are included
+	Latency Histogram `json:"latency,omitempty"`
 }
 
 type SubmitMetrics struct {
@@ -54,17 +63,31 @@ const (
 )
 
 type Traffic struct {
-	From         string `json:"from"`
-	To           string `json:"to"`
-	Ts           int64  `json:"ts"`
-	Duration     int    `json:"duration"`
-	CountGood    int64  `json:"count_good"`
-	CountWarning int64  `json:"count_warning"`
-	CountBad     int64  `json:"count_bad"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// The rest of the edge's identity, so that edges between the
+	// same two nodes over different transports or regions can be told apart
+	SourceRegion string    `json:"source_region,omitempty"`
+	SourceType   NodeType  `json:"source_type,omitempty"`
+	TargetRegion string    `json:"target_region,omitempty"`
+	TargetType   NodeType  `json:"target_type,omitempty"`
+	Transport    Transport `json:"transport,omitempty"`
+
+	Ts           int64 `json:"ts"`
+	Duration     int   `json:"duration"`
+	CountGood    int64 `json:"count_good"`
+	CountWarning int64 `json:"count_warning"`
+	CountBad     int64 `json:"count_bad"`
+
+	// LatencyP50 and LatencyP99 are in seconds, they are omitted when no calls were timed
+	LatencyP50 float64 `json:"latency_p50,omitempty"`
+	LatencyP99 float64 `json:"latency_p99,omitempty"`
 }
 
 type GetTrafficResponse struct {
 	Traffic []Traffic `json:"traffic"`
+	// NextOffset is set when there are more pages of traffic
+	NextOffset int `json:"next_offset,omitempty"`
 }
 
 type GetNodesResponse struct {
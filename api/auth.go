@@ -0,0 +1,24 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers used to sign submissions with an HMAC key
+const (
+	HeaderSignature          = "X-Gridlock-Signature"
+	HeaderSignatureTimestamp = "X-Gridlock-Timestamp"
+)
+
+// SignSubmission returns the hex encoded HMAC-SHA256 of a submission sent at ts (in unix seconds),
+// body is signed exactly as it is sent, after any compression
+func SignSubmission(key []byte, ts int64, body []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(strconv.FormatInt(ts, 10)))
+	m.Write([]byte("\n"))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
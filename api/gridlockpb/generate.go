@@ -0,0 +1,4 @@
+// Package gridlockpb is the generated code for the gridlock gRPC service
+package gridlockpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gridlock.proto
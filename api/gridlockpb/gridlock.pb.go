@@ -0,0 +1,1098 @@
+// The gridlock gRPC service. SubmitMetrics is also accepted by /gridlock/api/submit
+// with Content-Type application/x-protobuf, the api package encodes it by hand, see proto.go.
+// Run go generate after changing this file, see generate.go.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v6.32.1
+// source: gridlock.proto
+
+package gridlockpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubmitMetrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metrics             `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	NodeInfo      []*NodeInfo            `protobuf:"bytes,2,rep,name=node_info,json=nodeInfo,proto3" json:"node_info,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitMetrics) Reset() {
+	*x = SubmitMetrics{}
+	mi := &file_gridlock_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitMetrics) ProtoMessage() {}
+
+func (x *SubmitMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitMetrics.ProtoReflect.Descriptor instead.
+func (*SubmitMetrics) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitMetrics) GetMetrics() []*Metrics {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *SubmitMetrics) GetNodeInfo() []*NodeInfo {
+	if x != nil {
+		return x.NodeInfo
+	}
+	return nil
+}
+
+type Metrics struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Source       string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	SourceRegion string                 `protobuf:"bytes,2,opt,name=source_region,json=sourceRegion,proto3" json:"source_region,omitempty"`
+	SourceType   string                 `protobuf:"bytes,3,opt,name=source_type,json=sourceType,proto3" json:"source_type,omitempty"`
+	Transport    string                 `protobuf:"bytes,4,opt,name=transport,proto3" json:"transport,omitempty"`
+	Target       string                 `protobuf:"bytes,5,opt,name=target,proto3" json:"target,omitempty"`
+	TargetRegion string                 `protobuf:"bytes,6,opt,name=target_region,json=targetRegion,proto3" json:"target_region,omitempty"`
+	TargetType   string                 `protobuf:"bytes,7,opt,name=target_type,json=targetType,proto3" json:"target_type,omitempty"`
+	// Unix seconds
+	Timestamp int64 `protobuf:"varint,8,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Nanoseconds
+	Duration     int64 `protobuf:"varint,9,opt,name=duration,proto3" json:"duration,omitempty"`
+	CountGood    int64 `protobuf:"varint,10,opt,name=count_good,json=countGood,proto3" json:"count_good,omitempty"`
+	CountWarning int64 `protobuf:"varint,11,opt,name=count_warning,json=countWarning,proto3" json:"count_warning,omitempty"`
+	CountBad     int64 `protobuf:"varint,12,opt,name=count_bad,json=countBad,proto3" json:"count_bad,omitempty"`
+	// Histogram bucket counts, see Histogram in api/histogram.go
+	Latency       []int64 `protobuf:"varint,13,rep,packed,name=latency,proto3" json:"latency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metrics) Reset() {
+	*x = Metrics{}
+	mi := &file_gridlock_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metrics) ProtoMessage() {}
+
+func (x *Metrics) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metrics.ProtoReflect.Descriptor instead.
+func (*Metrics) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Metrics) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Metrics) GetSourceRegion() string {
+	if x != nil {
+		return x.SourceRegion
+	}
+	return ""
+}
+
+func (x *Metrics) GetSourceType() string {
+	if x != nil {
+		return x.SourceType
+	}
+	return ""
+}
+
+func (x *Metrics) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *Metrics) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *Metrics) GetTargetRegion() string {
+	if x != nil {
+		return x.TargetRegion
+	}
+	return ""
+}
+
+func (x *Metrics) GetTargetType() string {
+	if x != nil {
+		return x.TargetType
+	}
+	return ""
+}
+
+func (x *Metrics) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Metrics) GetDuration() int64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *Metrics) GetCountGood() int64 {
+	if x != nil {
+		return x.CountGood
+	}
+	return 0
+}
+
+func (x *Metrics) GetCountWarning() int64 {
+	if x != nil {
+		return x.CountWarning
+	}
+	return 0
+}
+
+func (x *Metrics) GetCountBad() int64 {
+	if x != nil {
+		return x.CountBad
+	}
+	return 0
+}
+
+func (x *Metrics) GetLatency() []int64 {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+type NodeInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Region        string                 `protobuf:"bytes,1,opt,name=region,proto3" json:"region,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	DisplayName   string                 `protobuf:"bytes,3,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	Type          string                 `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NodeInfo) Reset() {
+	*x = NodeInfo{}
+	mi := &file_gridlock_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeInfo) ProtoMessage() {}
+
+func (x *NodeInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeInfo.ProtoReflect.Descriptor instead.
+func (*NodeInfo) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *NodeInfo) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetDisplayName() string {
+	if x != nil {
+		return x.DisplayName
+	}
+	return ""
+}
+
+func (x *NodeInfo) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+type SubmitMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitMetricsResponse) Reset() {
+	*x = SubmitMetricsResponse{}
+	mi := &file_gridlock_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitMetricsResponse) ProtoMessage() {}
+
+func (x *SubmitMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitMetricsResponse.ProtoReflect.Descriptor instead.
+func (*SubmitMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{3}
+}
+
+type GetTrafficRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Unix seconds of a single bucket, all loaded traffic is returned when zero
+	Ts            int64 `protobuf:"varint,1,opt,name=ts,proto3" json:"ts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTrafficRequest) Reset() {
+	*x = GetTrafficRequest{}
+	mi := &file_gridlock_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTrafficRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTrafficRequest) ProtoMessage() {}
+
+func (x *GetTrafficRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTrafficRequest.ProtoReflect.Descriptor instead.
+func (*GetTrafficRequest) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetTrafficRequest) GetTs() int64 {
+	if x != nil {
+		return x.Ts
+	}
+	return 0
+}
+
+type Traffic struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	From         string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To           string                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	SourceRegion string                 `protobuf:"bytes,3,opt,name=source_region,json=sourceRegion,proto3" json:"source_region,omitempty"`
+	SourceType   string                 `protobuf:"bytes,4,opt,name=source_type,json=sourceType,proto3" json:"source_type,omitempty"`
+	TargetRegion string                 `protobuf:"bytes,5,opt,name=target_region,json=targetRegion,proto3" json:"target_region,omitempty"`
+	TargetType   string                 `protobuf:"bytes,6,opt,name=target_type,json=targetType,proto3" json:"target_type,omitempty"`
+	Transport    string                 `protobuf:"bytes,7,opt,name=transport,proto3" json:"transport,omitempty"`
+	// Unix seconds
+	Ts int64 `protobuf:"varint,8,opt,name=ts,proto3" json:"ts,omitempty"`
+	// Seconds
+	Duration     int64 `protobuf:"varint,9,opt,name=duration,proto3" json:"duration,omitempty"`
+	CountGood    int64 `protobuf:"varint,10,opt,name=count_good,json=countGood,proto3" json:"count_good,omitempty"`
+	CountWarning int64 `protobuf:"varint,11,opt,name=count_warning,json=countWarning,proto3" json:"count_warning,omitempty"`
+	CountBad     int64 `protobuf:"varint,12,opt,name=count_bad,json=countBad,proto3" json:"count_bad,omitempty"`
+	// Seconds, zero when no calls were timed
+	LatencyP50    float64 `protobuf:"fixed64,13,opt,name=latency_p50,json=latencyP50,proto3" json:"latency_p50,omitempty"`
+	LatencyP99    float64 `protobuf:"fixed64,14,opt,name=latency_p99,json=latencyP99,proto3" json:"latency_p99,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Traffic) Reset() {
+	*x = Traffic{}
+	mi := &file_gridlock_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Traffic) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Traffic) ProtoMessage() {}
+
+func (x *Traffic) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Traffic.ProtoReflect.Descriptor instead.
+func (*Traffic) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Traffic) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Traffic) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *Traffic) GetSourceRegion() string {
+	if x != nil {
+		return x.SourceRegion
+	}
+	return ""
+}
+
+func (x *Traffic) GetSourceType() string {
+	if x != nil {
+		return x.SourceType
+	}
+	return ""
+}
+
+func (x *Traffic) GetTargetRegion() string {
+	if x != nil {
+		return x.TargetRegion
+	}
+	return ""
+}
+
+func (x *Traffic) GetTargetType() string {
+	if x != nil {
+		return x.TargetType
+	}
+	return ""
+}
+
+func (x *Traffic) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *Traffic) GetTs() int64 {
+	if x != nil {
+		return x.Ts
+	}
+	return 0
+}
+
+func (x *Traffic) GetDuration() int64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *Traffic) GetCountGood() int64 {
+	if x != nil {
+		return x.CountGood
+	}
+	return 0
+}
+
+func (x *Traffic) GetCountWarning() int64 {
+	if x != nil {
+		return x.CountWarning
+	}
+	return 0
+}
+
+func (x *Traffic) GetCountBad() int64 {
+	if x != nil {
+		return x.CountBad
+	}
+	return 0
+}
+
+func (x *Traffic) GetLatencyP50() float64 {
+	if x != nil {
+		return x.LatencyP50
+	}
+	return 0
+}
+
+func (x *Traffic) GetLatencyP99() float64 {
+	if x != nil {
+		return x.LatencyP99
+	}
+	return 0
+}
+
+type WatchGraphRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Nanoseconds that each graph looks back, defaults to five minutes
+	Window int64 `protobuf:"varint,1,opt,name=window,proto3" json:"window,omitempty"`
+	// Nanoseconds between graphs, defaults to ten seconds
+	Interval      int64 `protobuf:"varint,2,opt,name=interval,proto3" json:"interval,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchGraphRequest) Reset() {
+	*x = WatchGraphRequest{}
+	mi := &file_gridlock_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchGraphRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchGraphRequest) ProtoMessage() {}
+
+func (x *WatchGraphRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchGraphRequest.ProtoReflect.Descriptor instead.
+func (*WatchGraphRequest) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchGraphRequest) GetWindow() int64 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *WatchGraphRequest) GetInterval() int64 {
+	if x != nil {
+		return x.Interval
+	}
+	return 0
+}
+
+// GraphNode is a vizceral node, see the api/vizceral package
+type GraphNode struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Class            string                 `protobuf:"bytes,1,opt,name=class,proto3" json:"class,omitempty"`
+	Layout           string                 `protobuf:"bytes,2,opt,name=layout,proto3" json:"layout,omitempty"`
+	Renderer         string                 `protobuf:"bytes,3,opt,name=renderer,proto3" json:"renderer,omitempty"`
+	NodeType         string                 `protobuf:"bytes,4,opt,name=node_type,json=nodeType,proto3" json:"node_type,omitempty"`
+	Name             string                 `protobuf:"bytes,5,opt,name=name,proto3" json:"name,omitempty"`
+	DisplayName      string                 `protobuf:"bytes,6,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	MaxVolume        float64                `protobuf:"fixed64,7,opt,name=max_volume,json=maxVolume,proto3" json:"max_volume,omitempty"`
+	EntryNode        string                 `protobuf:"bytes,8,opt,name=entry_node,json=entryNode,proto3" json:"entry_node,omitempty"`
+	Nodes            []*GraphNode           `protobuf:"bytes,9,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Connections      []*GraphConnection     `protobuf:"bytes,10,rep,name=connections,proto3" json:"connections,omitempty"`
+	Notices          []*GraphNotice         `protobuf:"bytes,11,rep,name=notices,proto3" json:"notices,omitempty"`
+	Updated          int64                  `protobuf:"varint,12,opt,name=updated,proto3" json:"updated,omitempty"`
+	ServerUpdateTime int64                  `protobuf:"varint,13,opt,name=server_update_time,json=serverUpdateTime,proto3" json:"server_update_time,omitempty"`
+	Metadata         map[string]string      `protobuf:"bytes,14,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *GraphNode) Reset() {
+	*x = GraphNode{}
+	mi := &file_gridlock_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraphNode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphNode) ProtoMessage() {}
+
+func (x *GraphNode) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphNode.ProtoReflect.Descriptor instead.
+func (*GraphNode) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GraphNode) GetClass() string {
+	if x != nil {
+		return x.Class
+	}
+	return ""
+}
+
+func (x *GraphNode) GetLayout() string {
+	if x != nil {
+		return x.Layout
+	}
+	return ""
+}
+
+func (x *GraphNode) GetRenderer() string {
+	if x != nil {
+		return x.Renderer
+	}
+	return ""
+}
+
+func (x *GraphNode) GetNodeType() string {
+	if x != nil {
+		return x.NodeType
+	}
+	return ""
+}
+
+func (x *GraphNode) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *GraphNode) GetDisplayName() string {
+	if x != nil {
+		return x.DisplayName
+	}
+	return ""
+}
+
+func (x *GraphNode) GetMaxVolume() float64 {
+	if x != nil {
+		return x.MaxVolume
+	}
+	return 0
+}
+
+func (x *GraphNode) GetEntryNode() string {
+	if x != nil {
+		return x.EntryNode
+	}
+	return ""
+}
+
+func (x *GraphNode) GetNodes() []*GraphNode {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *GraphNode) GetConnections() []*GraphConnection {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+func (x *GraphNode) GetNotices() []*GraphNotice {
+	if x != nil {
+		return x.Notices
+	}
+	return nil
+}
+
+func (x *GraphNode) GetUpdated() int64 {
+	if x != nil {
+		return x.Updated
+	}
+	return 0
+}
+
+func (x *GraphNode) GetServerUpdateTime() int64 {
+	if x != nil {
+		return x.ServerUpdateTime
+	}
+	return 0
+}
+
+func (x *GraphNode) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type GraphConnection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Source        string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Target        string                 `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`
+	Metrics       *GraphMetrics          `protobuf:"bytes,3,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	Notices       []*GraphNotice         `protobuf:"bytes,4,rep,name=notices,proto3" json:"notices,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GraphConnection) Reset() {
+	*x = GraphConnection{}
+	mi := &file_gridlock_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraphConnection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphConnection) ProtoMessage() {}
+
+func (x *GraphConnection) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphConnection.ProtoReflect.Descriptor instead.
+func (*GraphConnection) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GraphConnection) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *GraphConnection) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *GraphConnection) GetMetrics() *GraphMetrics {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *GraphConnection) GetNotices() []*GraphNotice {
+	if x != nil {
+		return x.Notices
+	}
+	return nil
+}
+
+func (x *GraphConnection) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type GraphNotice struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Title         string                 `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	Link          string                 `protobuf:"bytes,2,opt,name=link,proto3" json:"link,omitempty"`
+	Severity      int64                  `protobuf:"varint,3,opt,name=severity,proto3" json:"severity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GraphNotice) Reset() {
+	*x = GraphNotice{}
+	mi := &file_gridlock_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraphNotice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphNotice) ProtoMessage() {}
+
+func (x *GraphNotice) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphNotice.ProtoReflect.Descriptor instead.
+func (*GraphNotice) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GraphNotice) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *GraphNotice) GetLink() string {
+	if x != nil {
+		return x.Link
+	}
+	return ""
+}
+
+func (x *GraphNotice) GetSeverity() int64 {
+	if x != nil {
+		return x.Severity
+	}
+	return 0
+}
+
+type GraphMetrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Normal        float64                `protobuf:"fixed64,1,opt,name=normal,proto3" json:"normal,omitempty"`
+	Danger        float64                `protobuf:"fixed64,2,opt,name=danger,proto3" json:"danger,omitempty"`
+	Warning       float64                `protobuf:"fixed64,3,opt,name=warning,proto3" json:"warning,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GraphMetrics) Reset() {
+	*x = GraphMetrics{}
+	mi := &file_gridlock_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraphMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphMetrics) ProtoMessage() {}
+
+func (x *GraphMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_gridlock_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphMetrics.ProtoReflect.Descriptor instead.
+func (*GraphMetrics) Descriptor() ([]byte, []int) {
+	return file_gridlock_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GraphMetrics) GetNormal() float64 {
+	if x != nil {
+		return x.Normal
+	}
+	return 0
+}
+
+func (x *GraphMetrics) GetDanger() float64 {
+	if x != nil {
+		return x.Danger
+	}
+	return 0
+}
+
+func (x *GraphMetrics) GetWarning() float64 {
+	if x != nil {
+		return x.Warning
+	}
+	return 0
+}
+
+var File_gridlock_proto protoreflect.FileDescriptor
+
+const file_gridlock_proto_rawDesc = "" +
+	"\n" +
+	"\x0egridlock.proto\x12\bgridlock\"m\n" +
+	"\rSubmitMetrics\x12+\n" +
+	"\ametrics\x18\x01 \x03(\v2\x11.gridlock.MetricsR\ametrics\x12/\n" +
+	"\tnode_info\x18\x02 \x03(\v2\x12.gridlock.NodeInfoR\bnodeInfo\"\x98\x03\n" +
+	"\aMetrics\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12#\n" +
+	"\rsource_region\x18\x02 \x01(\tR\fsourceRegion\x12\x1f\n" +
+	"\vsource_type\x18\x03 \x01(\tR\n" +
+	"sourceType\x12\x1c\n" +
+	"\ttransport\x18\x04 \x01(\tR\ttransport\x12\x16\n" +
+	"\x06target\x18\x05 \x01(\tR\x06target\x12#\n" +
+	"\rtarget_region\x18\x06 \x01(\tR\ftargetRegion\x12\x1f\n" +
+	"\vtarget_type\x18\a \x01(\tR\n" +
+	"targetType\x12\x1c\n" +
+	"\ttimestamp\x18\b \x01(\x03R\ttimestamp\x12\x1a\n" +
+	"\bduration\x18\t \x01(\x03R\bduration\x12\x1d\n" +
+	"\n" +
+	"count_good\x18\n" +
+	" \x01(\x03R\tcountGood\x12#\n" +
+	"\rcount_warning\x18\v \x01(\x03R\fcountWarning\x12\x1b\n" +
+	"\tcount_bad\x18\f \x01(\x03R\bcountBad\x12\x18\n" +
+	"\alatency\x18\r \x03(\x03R\alatency\"m\n" +
+	"\bNodeInfo\x12\x16\n" +
+	"\x06region\x18\x01 \x01(\tR\x06region\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12!\n" +
+	"\fdisplay_name\x18\x03 \x01(\tR\vdisplayName\x12\x12\n" +
+	"\x04type\x18\x04 \x01(\tR\x04type\"\x17\n" +
+	"\x15SubmitMetricsResponse\"#\n" +
+	"\x11GetTrafficRequest\x12\x0e\n" +
+	"\x02ts\x18\x01 \x01(\x03R\x02ts\"\xa6\x03\n" +
+	"\aTraffic\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\tR\x02to\x12#\n" +
+	"\rsource_region\x18\x03 \x01(\tR\fsourceRegion\x12\x1f\n" +
+	"\vsource_type\x18\x04 \x01(\tR\n" +
+	"sourceType\x12#\n" +
+	"\rtarget_region\x18\x05 \x01(\tR\ftargetRegion\x12\x1f\n" +
+	"\vtarget_type\x18\x06 \x01(\tR\n" +
+	"targetType\x12\x1c\n" +
+	"\ttransport\x18\a \x01(\tR\ttransport\x12\x0e\n" +
+	"\x02ts\x18\b \x01(\x03R\x02ts\x12\x1a\n" +
+	"\bduration\x18\t \x01(\x03R\bduration\x12\x1d\n" +
+	"\n" +
+	"count_good\x18\n" +
+	" \x01(\x03R\tcountGood\x12#\n" +
+	"\rcount_warning\x18\v \x01(\x03R\fcountWarning\x12\x1b\n" +
+	"\tcount_bad\x18\f \x01(\x03R\bcountBad\x12\x1f\n" +
+	"\vlatency_p50\x18\r \x01(\x01R\n" +
+	"latencyP50\x12\x1f\n" +
+	"\vlatency_p99\x18\x0e \x01(\x01R\n" +
+	"latencyP99\"G\n" +
+	"\x11WatchGraphRequest\x12\x16\n" +
+	"\x06window\x18\x01 \x01(\x03R\x06window\x12\x1a\n" +
+	"\binterval\x18\x02 \x01(\x03R\binterval\"\xc4\x04\n" +
+	"\tGraphNode\x12\x14\n" +
+	"\x05class\x18\x01 \x01(\tR\x05class\x12\x16\n" +
+	"\x06layout\x18\x02 \x01(\tR\x06layout\x12\x1a\n" +
+	"\brenderer\x18\x03 \x01(\tR\brenderer\x12\x1b\n" +
+	"\tnode_type\x18\x04 \x01(\tR\bnodeType\x12\x12\n" +
+	"\x04name\x18\x05 \x01(\tR\x04name\x12!\n" +
+	"\fdisplay_name\x18\x06 \x01(\tR\vdisplayName\x12\x1d\n" +
+	"\n" +
+	"max_volume\x18\a \x01(\x01R\tmaxVolume\x12\x1d\n" +
+	"\n" +
+	"entry_node\x18\b \x01(\tR\tentryNode\x12)\n" +
+	"\x05nodes\x18\t \x03(\v2\x13.gridlock.GraphNodeR\x05nodes\x12;\n" +
+	"\vconnections\x18\n" +
+	" \x03(\v2\x19.gridlock.GraphConnectionR\vconnections\x12/\n" +
+	"\anotices\x18\v \x03(\v2\x15.gridlock.GraphNoticeR\anotices\x12\x18\n" +
+	"\aupdated\x18\f \x01(\x03R\aupdated\x12,\n" +
+	"\x12server_update_time\x18\r \x01(\x03R\x10serverUpdateTime\x12=\n" +
+	"\bmetadata\x18\x0e \x03(\v2!.gridlock.GraphNode.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa6\x02\n" +
+	"\x0fGraphConnection\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12\x16\n" +
+	"\x06target\x18\x02 \x01(\tR\x06target\x120\n" +
+	"\ametrics\x18\x03 \x01(\v2\x16.gridlock.GraphMetricsR\ametrics\x12/\n" +
+	"\anotices\x18\x04 \x03(\v2\x15.gridlock.GraphNoticeR\anotices\x12C\n" +
+	"\bmetadata\x18\x05 \x03(\v2'.gridlock.GraphConnection.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"S\n" +
+	"\vGraphNotice\x12\x14\n" +
+	"\x05title\x18\x01 \x01(\tR\x05title\x12\x12\n" +
+	"\x04link\x18\x02 \x01(\tR\x04link\x12\x1a\n" +
+	"\bseverity\x18\x03 \x01(\x03R\bseverity\"X\n" +
+	"\fGraphMetrics\x12\x16\n" +
+	"\x06normal\x18\x01 \x01(\x01R\x06normal\x12\x16\n" +
+	"\x06danger\x18\x02 \x01(\x01R\x06danger\x12\x18\n" +
+	"\awarning\x18\x03 \x01(\x01R\awarning2\xd7\x01\n" +
+	"\bGridlock\x12I\n" +
+	"\rSubmitMetrics\x12\x17.gridlock.SubmitMetrics\x1a\x1f.gridlock.SubmitMetricsResponse\x12>\n" +
+	"\n" +
+	"GetTraffic\x12\x1b.gridlock.GetTrafficRequest\x1a\x11.gridlock.Traffic0\x01\x12@\n" +
+	"\n" +
+	"WatchGraph\x12\x1b.gridlock.WatchGraphRequest\x1a\x13.gridlock.GraphNode0\x01B)Z'github.com/luno/gridlock/api/gridlockpbb\x06proto3"
+
+var (
+	file_gridlock_proto_rawDescOnce sync.Once
+	file_gridlock_proto_rawDescData []byte
+)
+
+func file_gridlock_proto_rawDescGZIP() []byte {
+	file_gridlock_proto_rawDescOnce.Do(func() {
+		file_gridlock_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_gridlock_proto_rawDesc), len(file_gridlock_proto_rawDesc)))
+	})
+	return file_gridlock_proto_rawDescData
+}
+
+var file_gridlock_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_gridlock_proto_goTypes = []any{
+	(*SubmitMetrics)(nil),         // 0: gridlock.SubmitMetrics
+	(*Metrics)(nil),               // 1: gridlock.Metrics
+	(*NodeInfo)(nil),              // 2: gridlock.NodeInfo
+	(*SubmitMetricsResponse)(nil), // 3: gridlock.SubmitMetricsResponse
+	(*GetTrafficRequest)(nil),     // 4: gridlock.GetTrafficRequest
+	(*Traffic)(nil),               // 5: gridlock.Traffic
+	(*WatchGraphRequest)(nil),     // 6: gridlock.WatchGraphRequest
+	(*GraphNode)(nil),             // 7: gridlock.GraphNode
+	(*GraphConnection)(nil),       // 8: gridlock.GraphConnection
+	(*GraphNotice)(nil),           // 9: gridlock.GraphNotice
+	(*GraphMetrics)(nil),          // 10: gridlock.GraphMetrics
+	nil,                           // 11: gridlock.GraphNode.MetadataEntry
+	nil,                           // 12: gridlock.GraphConnection.MetadataEntry
+}
+var file_gridlock_proto_depIdxs = []int32{
+	1,  // 0: gridlock.SubmitMetrics.metrics:type_name -> gridlock.Metrics
+	2,  // 1: gridlock.SubmitMetrics.node_info:type_name -> gridlock.NodeInfo
+	7,  // 2: gridlock.GraphNode.nodes:type_name -> gridlock.GraphNode
+	8,  // 3: gridlock.GraphNode.connections:type_name -> gridlock.GraphConnection
+	9,  // 4: gridlock.GraphNode.notices:type_name -> gridlock.GraphNotice
+	11, // 5: gridlock.GraphNode.metadata:type_name -> gridlock.GraphNode.MetadataEntry
+	10, // 6: gridlock.GraphConnection.metrics:type_name -> gridlock.GraphMetrics
+	9,  // 7: gridlock.GraphConnection.notices:type_name -> gridlock.GraphNotice
+	12, // 8: gridlock.GraphConnection.metadata:type_name -> gridlock.GraphConnection.MetadataEntry
+	0,  // 9: gridlock.Gridlock.SubmitMetrics:input_type -> gridlock.SubmitMetrics
+	4,  // 10: gridlock.Gridlock.GetTraffic:input_type -> gridlock.GetTrafficRequest
+	6,  // 11: gridlock.Gridlock.WatchGraph:input_type -> gridlock.WatchGraphRequest
+	3,  // 12: gridlock.Gridlock.SubmitMetrics:output_type -> gridlock.SubmitMetricsResponse
+	5,  // 13: gridlock.Gridlock.GetTraffic:output_type -> gridlock.Traffic
+	7,  // 14: gridlock.Gridlock.WatchGraph:output_type -> gridlock.GraphNode
+	12, // [12:15] is the sub-list for method output_type
+	9,  // [9:12] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_gridlock_proto_init() }
+func file_gridlock_proto_init() {
+	if File_gridlock_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gridlock_proto_rawDesc), len(file_gridlock_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_gridlock_proto_goTypes,
+		DependencyIndexes: file_gridlock_proto_depIdxs,
+		MessageInfos:      file_gridlock_proto_msgTypes,
+	}.Build()
+	File_gridlock_proto = out.File
+	file_gridlock_proto_goTypes = nil
+	file_gridlock_proto_depIdxs = nil
+}
@@ -0,0 +1,212 @@
+// The gridlock gRPC service. SubmitMetrics is also accepted by /gridlock/api/submit
+// with Content-Type application/x-protobuf, the api package encodes it by hand, see proto.go.
+// Run go generate after changing this file, see generate.go.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.32.1
+// source: gridlock.proto
+
+package gridlockpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Gridlock_SubmitMetrics_FullMethodName = "/gridlock.Gridlock/SubmitMetrics"
+	Gridlock_GetTraffic_FullMethodName    = "/gridlock.Gridlock/GetTraffic"
+	Gridlock_WatchGraph_FullMethodName    = "/gridlock.Gridlock/WatchGraph"
+)
+
+// GridlockClient is the client API for Gridlock service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GridlockClient interface {
+	SubmitMetrics(ctx context.Context, in *SubmitMetrics, opts ...grpc.CallOption) (*SubmitMetricsResponse, error)
+	// GetTraffic streams the loaded traffic, summarised per edge
+	GetTraffic(ctx context.Context, in *GetTrafficRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Traffic], error)
+	// WatchGraph streams the vizceral graph every interval until the call is cancelled
+	WatchGraph(ctx context.Context, in *WatchGraphRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GraphNode], error)
+}
+
+type gridlockClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGridlockClient(cc grpc.ClientConnInterface) GridlockClient {
+	return &gridlockClient{cc}
+}
+
+func (c *gridlockClient) SubmitMetrics(ctx context.Context, in *SubmitMetrics, opts ...grpc.CallOption) (*SubmitMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitMetricsResponse)
+	err := c.cc.Invoke(ctx, Gridlock_SubmitMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gridlockClient) GetTraffic(ctx context.Context, in *GetTrafficRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Traffic], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gridlock_ServiceDesc.Streams[0], Gridlock_GetTraffic_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetTrafficRequest, Traffic]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gridlock_GetTrafficClient = grpc.ServerStreamingClient[Traffic]
+
+func (c *gridlockClient) WatchGraph(ctx context.Context, in *WatchGraphRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GraphNode], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gridlock_ServiceDesc.Streams[1], Gridlock_WatchGraph_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchGraphRequest, GraphNode]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gridlock_WatchGraphClient = grpc.ServerStreamingClient[GraphNode]
+
+// GridlockServer is the server API for Gridlock service.
+// All implementations must embed UnimplementedGridlockServer
+// for forward compatibility.
+type GridlockServer interface {
+	SubmitMetrics(context.Context, *SubmitMetrics) (*SubmitMetricsResponse, error)
+	// GetTraffic streams the loaded traffic, summarised per edge
+	GetTraffic(*GetTrafficRequest, grpc.ServerStreamingServer[Traffic]) error
+	// WatchGraph streams the vizceral graph every interval until the call is cancelled
+	WatchGraph(*WatchGraphRequest, grpc.ServerStreamingServer[GraphNode]) error
+	mustEmbedUnimplementedGridlockServer()
+}
+
+// UnimplementedGridlockServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGridlockServer struct{}
+
+func (UnimplementedGridlockServer) SubmitMetrics(context.Context, *SubmitMetrics) (*SubmitMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitMetrics not implemented")
+}
+func (UnimplementedGridlockServer) GetTraffic(*GetTrafficRequest, grpc.ServerStreamingServer[Traffic]) error {
+	return status.Errorf(codes.Unimplemented, "method GetTraffic not implemented")
+}
+func (UnimplementedGridlockServer) WatchGraph(*WatchGraphRequest, grpc.ServerStreamingServer[GraphNode]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchGraph not implemented")
+}
+func (UnimplementedGridlockServer) mustEmbedUnimplementedGridlockServer() {}
+func (UnimplementedGridlockServer) testEmbeddedByValue()                  {}
+
+// UnsafeGridlockServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GridlockServer will
+// result in compilation errors.
+type UnsafeGridlockServer interface {
+	mustEmbedUnimplementedGridlockServer()
+}
+
+func RegisterGridlockServer(s grpc.ServiceRegistrar, srv GridlockServer) {
+	// If the following call pancis, it indicates UnimplementedGridlockServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Gridlock_ServiceDesc, srv)
+}
+
+func _Gridlock_SubmitMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitMetrics)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GridlockServer).SubmitMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gridlock_SubmitMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GridlockServer).SubmitMetrics(ctx, req.(*SubmitMetrics))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gridlock_GetTraffic_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetTrafficRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GridlockServer).GetTraffic(m, &grpc.GenericServerStream[GetTrafficRequest, Traffic]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gridlock_GetTrafficServer = grpc.ServerStreamingServer[Traffic]
+
+func _Gridlock_WatchGraph_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchGraphRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GridlockServer).WatchGraph(m, &grpc.GenericServerStream[WatchGraphRequest, GraphNode]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gridlock_WatchGraphServer = grpc.ServerStreamingServer[GraphNode]
+
+// Gridlock_ServiceDesc is the grpc.ServiceDesc for Gridlock service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gridlock_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gridlock.Gridlock",
+	HandlerType: (*GridlockServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitMetrics",
+			Handler:    _Gridlock_SubmitMetrics_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetTraffic",
+			Handler:       _Gridlock_GetTraffic_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchGraph",
+			Handler:       _Gridlock_WatchGraph_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gridlock.proto",
+}
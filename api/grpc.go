@@ -0,0 +1,112 @@
+package api
+
+import (
+	"time"
+
+	"github.com/luno/gridlock/api/gridlockpb"
+)
+
+// The gridlock gRPC service is defined in gridlockpb/gridlock.proto,
+// these convert between its messages and the types in this package.
+
+// ToProto converts s to the message for Gridlock.SubmitMetrics
+func (s SubmitMetrics) ToProto() *gridlockpb.SubmitMetrics {
+	ret := &gridlockpb.SubmitMetrics{}
+	for _, m := range s.Metrics {
+		ret.Metrics = append(ret.Metrics, &gridlockpb.Metrics{
+			Source:       m.Source,
+			SourceRegion: m.SourceRegion,
+			SourceType:   string(m.SourceType),
+			Transport:    string(m.Transport),
+			Target:       m.Target,
+			TargetRegion: m.TargetRegion,
+			TargetType:   string(m.TargetType),
+			Timestamp:    m.Timestamp,
+			Duration:     int64(m.Duration),
+			CountGood:    m.CountGood,
+			CountWarning: m.CountWarning,
+			CountBad:     m.CountBad,
+			Latency:      m.Latency,
+		})
+	}
+	for _, n := range s.NodeInfo {
+		ret.NodeInfo = append(ret.NodeInfo, &gridlockpb.NodeInfo{
+			Region:      n.Region,
+			Name:        n.Name,
+			DisplayName: n.DisplayName,
+			Type:        string(n.Type),
+		})
+	}
+	return ret
+}
+
+// SubmitMetricsFromProto converts the message for Gridlock.SubmitMetrics
+func SubmitMetricsFromProto(p *gridlockpb.SubmitMetrics) SubmitMetrics {
+	var ret SubmitMetrics
+	for _, m := range p.GetMetrics() {
+		ret.Metrics = append(ret.Metrics, Metrics{
+			Source:       m.GetSource(),
+			SourceRegion: m.GetSourceRegion(),
+			SourceType:   NodeType(m.GetSourceType()),
+			Transport:    Transport(m.GetTransport()),
+			Target:       m.GetTarget(),
+			TargetRegion: m.GetTargetRegion(),
+			TargetType:   NodeType(m.GetTargetType()),
+			Timestamp:    m.GetTimestamp(),
+			Duration:     time.Duration(m.GetDuration()),
+			CountGood:    m.GetCountGood(),
+			CountWarning: m.GetCountWarning(),
+			CountBad:     m.GetCountBad(),
+			Latency:      m.GetLatency(),
+		})
+	}
+	for _, n := range p.GetNodeInfo() {
+		ret.NodeInfo = append(ret.NodeInfo, NodeInfo{
+			Region:      n.GetRegion(),
+			Name:        n.GetName(),
+			DisplayName: n.GetDisplayName(),
+			Type:        NodeType(n.GetType()),
+		})
+	}
+	return ret
+}
+
+// ToProto converts t to the message streamed by Gridlock.GetTraffic
+func (t Traffic) ToProto() *gridlockpb.Traffic {
+	return &gridlockpb.Traffic{
+		From:         t.From,
+		To:           t.To,
+		SourceRegion: t.SourceRegion,
+		SourceType:   string(t.SourceType),
+		TargetRegion: t.TargetRegion,
+		TargetType:   string(t.TargetType),
+		Transport:    string(t.Transport),
+		Ts:           t.Ts,
+		Duration:     int64(t.Duration),
+		CountGood:    t.CountGood,
+		CountWarning: t.CountWarning,
+		CountBad:     t.CountBad,
+		LatencyP50:   t.LatencyP50,
+		LatencyP99:   t.LatencyP99,
+	}
+}
+
+// TrafficFromProto converts a message streamed by Gridlock.GetTraffic
+func TrafficFromProto(p *gridlockpb.Traffic) Traffic {
+	return Traffic{
+		From:         p.GetFrom(),
+		To:           p.GetTo(),
+		SourceRegion: p.GetSourceRegion(),
+		SourceType:   NodeType(p.GetSourceType()),
+		TargetRegion: p.GetTargetRegion(),
+		TargetType:   NodeType(p.GetTargetType()),
+		Transport:    Transport(p.GetTransport()),
+		Ts:           p.GetTs(),
+		Duration:     int(p.GetDuration()),
+		CountGood:    p.GetCountGood(),
+		CountWarning: p.GetCountWarning(),
+		CountBad:     p.GetCountBad(),
+		LatencyP50:   p.GetLatencyP50(),
+		LatencyP99:   p.GetLatencyP99(),
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// HistogramBuckets is the maximum length of a Histogram
+	HistogramBuckets = 48
+
+	histogramBase = 100 * time.Microsecond
+)
+
+// Histogram counts call durations in exponentially sized buckets,
+// bucket i counts calls which took at most HistogramBound(i)
+// and the last bucket counts everything longer.
+// Trailing empty buckets are omitted.
+type Histogram []int64
+
+var histogramBounds = func() [HistogramBuckets]time.Duration {
+	var b [HistogramBuckets]time.Duration
+	for i := range b {
+		b[i] = time.Duration(float64(histogramBase) * math.Pow(math.Sqrt2, float64(i)))
+	}
+	return b
+}()
+
+// HistogramBound returns the upper bound of bucket i, each bucket is √2 times wider than the last
+func HistogramBound(i int) time.Duration {
+	return histogramBounds[i]
+}
+
+// HistogramBucket returns the index of the bucket which counts d
+func HistogramBucket(d time.Duration) int {
+	i := sort.Search(HistogramBuckets-1, func(i int) bool {
+		return d <= histogramBounds[i]
+	})
+	return i
+}
+
+// Add returns the histogram with n calls of duration d added
+func (h Histogram) Add(d time.Duration, n int64) Histogram {
+	i := HistogramBucket(d)
+	if i >= len(h) {
+		h = append(h, make(Histogram, i-len(h)+1)...)
+	}
+	h[i] += n
+	return h
+}
+
+// Merge returns a new histogram with the counts from both h and o
+func (h Histogram) Merge(o Histogram) Histogram {
+	if len(h) == 0 && len(o) == 0 {
+		return nil
+	}
+	ret := make(Histogram, max(len(h), len(o)))
+	copy(ret, h)
+	for i, n := range o {
+		ret[i] += n
+	}
+	return ret
+}
+
+// Count is the total number of calls in the histogram
+func (h Histogram) Count() int64 {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	return total
+}
+
+// Quantile estimates the duration below which a fraction q of calls completed,
+// interpolating linearly within the bucket containing the quantile
+func (h Histogram) Quantile(q float64) time.Duration {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, n := range h {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) < rank {
+			seen += float64(n)
+			continue
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = HistogramBound(i - 1)
+		}
+		upper := HistogramBound(i)
+		frac := (rank - seen) / float64(n)
+		return lower + time.Duration(frac*float64(upper-lower))
+	}
+	return HistogramBound(len(h) - 1)
+}
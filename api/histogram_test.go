@@ -0,0 +1,60 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	testCases := []struct {
+		name   string
+		d      time.Duration
+		expIdx int
+	}{
+		{name: "zero", d: 0, expIdx: 0},
+		{name: "base", d: 100 * time.Microsecond, expIdx: 0},
+		{name: "just over base", d: 101 * time.Microsecond, expIdx: 1},
+		{name: "double base", d: 200 * time.Microsecond, expIdx: 2},
+		{name: "just over double", d: 201 * time.Microsecond, expIdx: 3},
+		{name: "huge", d: 24 * time.Hour, expIdx: HistogramBuckets - 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			i := HistogramBucket(tc.d)
+			assert.Equal(t, tc.expIdx, i)
+			if i < HistogramBuckets-1 {
+				assert.LessOrEqual(t, tc.d, HistogramBound(i))
+			}
+		})
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a := Histogram{1, 2}
+	b := Histogram{0, 1, 3}
+	assert.Equal(t, Histogram{1, 3, 3}, a.Merge(b))
+	assert.Equal(t, Histogram{1, 2}, a)
+	assert.Nil(t, Histogram(nil).Merge(nil))
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	var h Histogram
+	for i := 0; i < 99; i++ {
+		h = h.Add(time.Millisecond, 1)
+	}
+	h = h.Add(time.Second, 1)
+
+	assert.Equal(t, int64(100), h.Count())
+
+	p50 := h.Quantile(0.5)
+	assert.Greater(t, p50, HistogramBound(HistogramBucket(time.Millisecond)-1))
+	assert.LessOrEqual(t, p50, HistogramBound(HistogramBucket(time.Millisecond)))
+
+	p100 := h.Quantile(1)
+	assert.Greater(t, p100, 700*time.Millisecond)
+	assert.LessOrEqual(t, p100, HistogramBound(HistogramBucket(time.Second)))
+
+	assert.Zero(t, Histogram(nil).Quantile(0.99))
+}
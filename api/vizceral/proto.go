@@ -0,0 +1,89 @@
+package vizceral
+
+import "github.com/luno/gridlock/api/gridlockpb"
+
+// ToProto converts n to the message streamed by Gridlock.WatchGraph
+func (n Node) ToProto() *gridlockpb.GraphNode {
+	ret := &gridlockpb.GraphNode{
+		Class:            string(n.Class),
+		Layout:           n.Layout,
+		Renderer:         string(n.Renderer),
+		NodeType:         string(n.NodeType),
+		Name:             n.Name,
+		DisplayName:      n.DisplayName,
+		MaxVolume:        n.MaxVolume,
+		EntryNode:        n.EntryNode,
+		Notices:          noticesToProto(n.Notices),
+		Updated:          n.Updated,
+		ServerUpdateTime: n.ServerUpdateTime,
+		Metadata:         n.Metadata,
+	}
+	for _, c := range n.Nodes {
+		ret.Nodes = append(ret.Nodes, c.ToProto())
+	}
+	for _, c := range n.Connections {
+		ret.Connections = append(ret.Connections, &gridlockpb.GraphConnection{
+			Source: c.Source,
+			Target: c.Target,
+			Metrics: &gridlockpb.GraphMetrics{
+				Normal:  c.Metrics.Normal,
+				Danger:  c.Metrics.Danger,
+				Warning: c.Metrics.Warning,
+			},
+			Notices:  noticesToProto(c.Notices),
+			Metadata: c.Metadata,
+		})
+	}
+	return ret
+}
+
+// NodeFromProto converts a message streamed by Gridlock.WatchGraph
+func NodeFromProto(p *gridlockpb.GraphNode) Node {
+	ret := Node{
+		Class:            NodeClass(p.GetClass()),
+		Layout:           p.GetLayout(),
+		Renderer:         NodeRenderer(p.GetRenderer()),
+		NodeType:         NodeType(p.GetNodeType()),
+		Name:             p.GetName(),
+		DisplayName:      p.GetDisplayName(),
+		MaxVolume:        p.GetMaxVolume(),
+		EntryNode:        p.GetEntryNode(),
+		Notices:          noticesFromProto(p.GetNotices()),
+		Updated:          p.GetUpdated(),
+		ServerUpdateTime: p.GetServerUpdateTime(),
+		Metadata:         p.GetMetadata(),
+	}
+	for _, c := range p.GetNodes() {
+		ret.Nodes = append(ret.Nodes, NodeFromProto(c))
+	}
+	for _, c := range p.GetConnections() {
+		ret.Connections = append(ret.Connections, Connection{
+			Source: c.GetSource(),
+			Target: c.GetTarget(),
+			Metrics: Metrics{
+				Normal:  c.GetMetrics().GetNormal(),
+				Danger:  c.GetMetrics().GetDanger(),
+				Warning: c.GetMetrics().GetWarning(),
+			},
+			Notices:  noticesFromProto(c.GetNotices()),
+			Metadata: c.GetMetadata(),
+		})
+	}
+	return ret
+}
+
+func noticesToProto(nl []Notice) []*gridlockpb.GraphNotice {
+	var ret []*gridlockpb.GraphNotice
+	for _, n := range nl {
+		ret = append(ret, &gridlockpb.GraphNotice{Title: n.Title, Link: n.Link, Severity: int64(n.Severity)})
+	}
+	return ret
+}
+
+func noticesFromProto(nl []*gridlockpb.GraphNotice) []Notice {
+	var ret []Notice
+	for _, n := range nl {
+		ret = append(ret, Notice{Title: n.GetTitle(), Link: n.GetLink(), Severity: int(n.GetSeverity())})
+	}
+	return ret
+}
@@ -0,0 +1,63 @@
+package gridlock
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/luno/jettison/errors"
+	"google.golang.org/grpc/codes"
+)
+
+// GRPCClassifier decides how a call which finished with a status code is reported
+type GRPCClassifier func(code codes.Code) CallSuccess
+
+// SQLClassifier decides how a query which returned err is reported
+type SQLClassifier func(err error) CallSuccess
+
+// HTTPClassifier decides how a call which received a status code is reported
+type HTTPClassifier func(status int) CallSuccess
+
+// DefaultGRPCClassifier reports errors caused by the caller as warnings
+// and everything else which isn't OK as bad
+func DefaultGRPCClassifier(code codes.Code) CallSuccess {
+	switch code {
+	case codes.OK:
+		return CallGood
+	case codes.Canceled,
+		codes.InvalidArgument,
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.PermissionDenied,
+		codes.Unauthenticated,
+		codes.ResourceExhausted,
+		codes.FailedPrecondition,
+		codes.OutOfRange:
+		return CallWarning
+	default:
+		return CallBad
+	}
+}
+
+// DefaultHTTPClassifier reports 4xx responses as warnings and 5xx responses as bad
+func DefaultHTTPClassifier(status int) CallSuccess {
+	switch {
+	case status >= http.StatusContinue && status < http.StatusBadRequest:
+		return CallGood
+	case status >= http.StatusBadRequest && status < http.StatusInternalServerError:
+		return CallWarning
+	default:
+		return CallBad
+	}
+}
+
+// DefaultSQLClassifier reports cancelled queries as warnings and any other error as bad
+func DefaultSQLClassifier(err error) CallSuccess {
+	switch {
+	case err == nil:
+		return CallGood
+	case errors.Is(err, context.Canceled):
+		return CallWarning
+	default:
+		return CallBad
+	}
+}
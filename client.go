@@ -2,19 +2,26 @@ package gridlock
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
+	"google.golang.org/grpc"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/api/gridlockpb"
 )
 
 type CallAggregate [3]int64
@@ -43,13 +50,35 @@ type Client struct {
 	defaultMethod Method
 
 	flushChan   chan chan error
+	closeChan   chan closeRequest
+	closed      chan struct{}
 	flushPeriod time.Duration
 	reqTimeout  time.Duration
 
-	q chan incCall
+	q            chan incCall
+	queueSize    int
+	backpressure Backpressure
+	blockTimeout time.Duration
+	counters     *counterMap
+
+	encoding Encoding
+	gzip     bool
+	grpcConn grpc.ClientConnInterface
+
+	bearerToken string
+	hmacKey     []byte
+
+	spool *spool
+
+	nonFatal   bool
+	minBackoff time.Duration
+	maxBackoff time.Duration
 }
 
-var errRetryable = errors.New("", j.C("ERR_43d3926acd268ae8"))
+var (
+	errRetryable    = errors.New("", j.C("ERR_43d3926acd268ae8"))
+	ErrClientClosed = errors.New("client closed", j.C("ERR_2b6c2110b8668de1"))
+)
 
 type ClientOption func(*Client)
 
@@ -77,6 +106,62 @@ func WithFlushPeriod(t time.Duration) ClientOption {
 	}
 }
 
+// Encoding is the format used to submit metrics to the server
+type Encoding int
+
+const (
+	EncodingJSON  Encoding = 0
+	EncodingProto Encoding = 1
+)
+
+func WithEncoding(e Encoding) ClientOption {
+	return func(client *Client) {
+		client.encoding = e
+	}
+}
+
+// WithGzip compresses submitted metrics
+func WithGzip() ClientOption {
+	return func(client *Client) {
+		client.gzip = true
+	}
+}
+
+// WithGRPCConn submits metrics and fetches traffic over gRPC using cc instead of HTTP,
+// the base URL and HTTP client are not used and WithEncoding has no effect
+func WithGRPCConn(cc grpc.ClientConnInterface) ClientOption {
+	return func(client *Client) {
+		client.grpcConn = cc
+	}
+}
+
+// WithBearerToken authenticates submissions with one of the server's configured bearer tokens
+func WithBearerToken(token string) ClientOption {
+	return func(client *Client) {
+		client.bearerToken = token
+	}
+}
+
+// WithHMACKey signs submissions with one of the server's configured HMAC keys,
+// signing is not supported with WithGRPCConn
+func WithHMACKey(key []byte) ClientOption {
+	return func(client *Client) {
+		client.hmacKey = key
+	}
+}
+
+// WithNonFatalDelivery keeps Deliver running when submissions fail,
+// failed batches are merged into the next one (or spooled if WithSpool is used)
+// and submission is delayed by an exponential backoff between minBackoff and maxBackoff.
+// NewClient panics unless minBackoff is positive and no more than maxBackoff.
+func WithNonFatalDelivery(minBackoff, maxBackoff time.Duration) ClientOption {
+	return func(client *Client) {
+		client.nonFatal = true
+		client.minBackoff = minBackoff
+		client.maxBackoff = maxBackoff
+	}
+}
+
 type Metrics struct {
 	SuccessfulCalls   Counter
 	DroppedCalls      Counter
@@ -111,31 +196,49 @@ func WithMetrics(m Metrics) ClientOption {
 
 func NewClient(opts ...ClientOption) *Client {
 	ret := &Client{
-		cli:         http.DefaultClient,
-		now:         time.Now,
-		flushChan:   make(chan chan error, 1),
-		flushPeriod: 20 * time.Second,
-		reqTimeout:  30 * time.Second,
-		q:           make(chan incCall, 1000),
+		cli:          http.DefaultClient,
+		now:          time.Now,
+		flushChan:    make(chan chan error),
+		closeChan:    make(chan closeRequest),
+		closed:       make(chan struct{}),
+		flushPeriod:  20 * time.Second,
+		reqTimeout:   30 * time.Second,
+		queueSize:    1000,
+		blockTimeout: 100 * time.Millisecond,
+		backpressure: BackpressureAggregate,
+		counters:     newCounterMap(),
 	}
 	for _, opt := range opts {
 		opt(ret)
 	}
+	ret.q = make(chan incCall, ret.queueSize)
 	ret.metrics.defaultUnused()
 	if ret.cli == nil {
 		panic("no http client specified")
 	}
+	if ret.grpcConn != nil && ret.hmacKey != nil {
+		panic("hmac signing is not supported over grpc")
+	}
+	if ret.nonFatal && (ret.minBackoff <= 0 || ret.maxBackoff < ret.minBackoff) {
+		panic("non-fatal delivery needs a positive backoff")
+	}
+	if ret.spool != nil {
+		ret.spool.now = ret.now
+	}
 	return ret
 }
 
 type incCall struct {
-	M       Method
-	Success CallSuccess
-	Done    chan struct{}
+	M        Method
+	Success  CallSuccess
+	Duration time.Duration
+	Timed    bool
+	Done     chan struct{}
 }
 
 type aggregate struct {
 	Calls   map[Method]CallAggregate
+	Latency map[Method]api.Histogram
 	Started time.Time
 	Ended   time.Time
 }
@@ -143,6 +246,7 @@ type aggregate struct {
 func newAggregate(ts time.Time) aggregate {
 	return aggregate{
 		Calls:   make(map[Method]CallAggregate),
+		Latency: make(map[Method]api.Histogram),
 		Started: ts,
 	}
 }
@@ -160,63 +264,265 @@ func (a aggregate) Record(m Method, s CallSuccess) {
 	a.Calls[m] = l
 }
 
+// RecordCall aggregates a call from the queue and marks it done
+func (a aggregate) RecordCall(call incCall) {
+	a.Record(call.M, call.Success)
+	if call.Timed {
+		a.RecordDuration(call.M, call.Duration)
+	}
+	close(call.Done)
+}
+
+func (a aggregate) RecordDuration(m Method, d time.Duration) {
+	a.Latency[m] = a.Latency[m].Add(d, 1)
+}
+
+// Merge adds the calls from o into a, extending a to start when o started
+func (a *aggregate) Merge(o aggregate) {
+	for m, calls := range o.Calls {
+		l := a.Calls[m]
+		for i := range l {
+			l[i] += calls[i]
+		}
+		a.Calls[m] = l
+	}
+	for m, h := range o.Latency {
+		a.Latency[m] = a.Latency[m].Merge(h)
+	}
+	if o.Started.Before(a.Started) {
+		a.Started = o.Started
+	}
+}
+
 func (a *aggregate) Close(ts time.Time) {
 	a.Ended = ts
 }
 
+// Record counts a call, the returned channel is closed once the call has been aggregated.
+// By default calls are counted directly and the channel is already closed.
 func (c *Client) Record(m Method, s CallSuccess) chan struct{} {
-	done := make(chan struct{})
+	return c.record(incCall{M: m.Merge(c.defaultMethod), Success: s})
+}
+
+// RecordDuration records a call along with how long it took,
+// durations are summarised into a latency histogram for each Method
+func (c *Client) RecordDuration(m Method, s CallSuccess, d time.Duration) chan struct{} {
+	return c.record(incCall{M: m.Merge(c.defaultMethod), Success: s, Duration: d, Timed: true})
+}
+
+// recordInbound records a call received by the local service, see inboundMethod.
+// The default method describes the target rather than the caller, so m isn't merged with it.
+func (c *Client) recordInbound(m Method, s CallSuccess, d time.Duration) chan struct{} {
+	return c.record(incCall{M: m, Success: s, Duration: d, Timed: true})
+}
+
+func (c *Client) record(call incCall) chan struct{} {
 	select {
-	case c.q <- incCall{M: m.Merge(c.defaultMethod), Success: s, Done: done}:
-		c.metrics.SuccessfulCalls.Inc()
+	case <-c.closed:
+		c.metrics.DroppedCalls.Inc()
+		return closedDone
 	default:
+	}
+	if c.backpressure == BackpressureAggregate {
+		c.counters.Record(call)
+		c.metrics.SuccessfulCalls.Inc()
+		return closedDone
+	}
+
+	done := make(chan struct{})
+	call.Done = done
+	if c.enqueue(call) {
+		c.metrics.SuccessfulCalls.Inc()
+	} else {
 		c.metrics.DroppedCalls.Inc()
 		close(done)
 	}
 	return done
 }
 
+// closedDone is returned for calls which have already been aggregated
+var closedDone = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func (c *Client) enqueue(call incCall) bool {
+	select {
+	case c.q <- call:
+		return true
+	default:
+	}
+	if c.backpressure != BackpressureBlock {
+		return false
+	}
+	t := time.NewTimer(c.blockTimeout)
+	defer t.Stop()
+	select {
+	case c.q <- call:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+type closeRequest struct {
+	Ctx   context.Context
+	Reply chan<- error
+}
+
+type batchResult struct {
+	Agg     aggregate
+	Err     error
+	Spooled bool
+	Reply   chan<- error
+}
+
+// Deliver aggregates recorded calls and submits them every flush period until ctx is cancelled
+// or the client is closed. It returns the first error from a periodic submission unless
+// WithNonFatalDelivery is used.
 func (c *Client) Deliver(ctx context.Context) error {
+	select {
+	case <-c.closed:
+		return ErrClientClosed
+	default:
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	t := time.NewTicker(c.flushPeriod)
 	defer t.Stop()
 
-	flush := func(ctx context.Context, agg aggregate, ch chan<- error) aggregate {
+	results := make(chan batchResult)
+	var inflight int
+	flush := func(ctx context.Context, agg aggregate, reply chan<- error) aggregate {
+		c.counters.DrainInto(agg)
 		ts := c.now()
 		agg.Close(ts)
+		inflight++
 		go func() {
-			ch <- c.sendBatch(ctx, agg)
+			res := batchResult{Agg: agg, Reply: reply}
+			res.Spooled, res.Err = c.sendBatch(ctx, agg)
+			select {
+			case results <- res:
+			case <-ctx.Done():
+			}
 		}()
 		return newAggregate(ts)
 	}
 	agg := newAggregate(c.now())
 
-	sendErrors := make(chan error)
+	// Pick up batches spooled before we started
+	go c.replaySpool(ctx)
+
+	backoff := c.minBackoff
+	var retryAt time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case call := <-c.q:
-			agg.Record(call.M, call.Success)
-			close(call.Done)
+			agg.RecordCall(call)
 		case <-t.C:
-			agg = flush(ctx, agg, sendErrors)
-		case err := <-sendErrors:
-			if err != nil {
-				return err
+			if c.now().Before(retryAt) {
+				// Keep aggregating until we've backed off
+				continue
 			}
+			agg = flush(ctx, agg, nil)
+		case res := <-results:
+			inflight--
+			if res.Reply != nil {
+				res.Reply <- res.Err
+			}
+			if res.Err == nil {
+				backoff = c.minBackoff
+				retryAt = time.Time{}
+				continue
+			}
+			if !c.nonFatal {
+				if res.Reply == nil {
+					return res.Err
+				}
+				continue
+			}
+			log.Error(ctx, errors.Wrap(res.Err, "failed to deliver batch"))
+			if !res.Spooled {
+				// Keep batches which couldn't be spooled for the next submission
+				agg.Merge(res.Agg)
+			}
+			retryAt = c.now().Add(backoff)
+			backoff = min(2*backoff, c.maxBackoff)
 		case ch := <-c.flushChan:
 			agg = flush(ctx, agg, ch)
+		case req := <-c.closeChan:
+			close(c.closed)
+			req.Reply <- c.drainAndSend(req.Ctx, agg, results, inflight)
+			return nil
+		}
+	}
+}
+
+// drainAndSend submits everything still waiting to be aggregated
+// and waits for the batches which are already being sent
+func (c *Client) drainAndSend(ctx context.Context, agg aggregate, results <-chan batchResult, inflight int) error {
+	for drained := false; !drained; {
+		select {
+		case call := <-c.q:
+			agg.RecordCall(call)
+		default:
+			drained = true
+		}
+	}
+	c.counters.DrainInto(agg)
+	agg.Close(c.now())
+
+	_, err := c.sendBatch(ctx, agg)
+	for ; inflight > 0; inflight-- {
+		select {
+		case res := <-results:
+			if res.Reply != nil {
+				res.Reply <- res.Err
+			}
+			if err == nil {
+				err = res.Err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+	return err
 }
 
+// Close stops Deliver after submitting all the calls recorded so far,
+// calls recorded after Close are dropped and closing again returns ErrClientClosed.
+// Deliver must be running for Close to complete.
+func (c *Client) Close(ctx context.Context) error {
+	rep := make(chan error, 1)
+	select {
+	case c.closeChan <- closeRequest{Ctx: ctx, Reply: rep}:
+	case <-c.closed:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-rep:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush submits the calls recorded so far and waits for them to be sent,
+// it returns ErrClientClosed once the client has been closed.
+// Deliver must be running for Flush to complete.
 func (c *Client) Flush(ctx context.Context) error {
 	rep := make(chan error, 1)
 	select {
 	case c.flushChan <- rep:
+	case <-c.closed:
+		return ErrClientClosed
 	case <-ctx.Done():
 		return ctx.Err()
 	}
@@ -241,11 +547,11 @@ func wrapHTTPError(err error) error {
 	return err
 }
 
-func (c *Client) doRetry(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+func (c *Client) doRetry(ctx context.Context, method, path string, body []byte, h http.Header) ([]byte, error) {
 	retries := 4
 	wait := time.Second
 	for {
-		resp, err := c.do(ctx, method, path, body)
+		resp, err := c.do(ctx, method, path, body, h)
 		if err == nil {
 			return resp, nil
 		}
@@ -263,7 +569,7 @@ func (c *Client) doRetry(ctx context.Context, method, path string, body []byte)
 	}
 }
 
-func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+func (c *Client) do(ctx context.Context, method, path string, body []byte, h http.Header) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.reqTimeout)
 	defer cancel()
 
@@ -271,13 +577,14 @@ func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]by
 	if err != nil {
 		return nil, errors.Wrap(err, "")
 	}
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	for k, v := range h {
+		req.Header[k] = v
 	}
 	resp, err := c.cli.Do(req)
 	if err != nil {
 		return nil, wrapHTTPError(err)
 	}
+	defer resp.Body.Close()
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to read response")
@@ -289,12 +596,7 @@ func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]by
 	return nil, errors.New("failed to submit", j.MKV{"response": s})
 }
 
-func (c *Client) sendBatch(ctx context.Context, a aggregate) error {
-	if len(a.Calls) == 0 {
-		return nil
-	}
-
-	t0 := time.Now()
+func (a aggregate) submission() (api.SubmitMetrics, int64) {
 	dur := a.Ended.Sub(a.Started)
 
 	var sub api.SubmitMetrics
@@ -313,15 +615,39 @@ func (c *Client) sendBatch(ctx context.Context, a aggregate) error {
 			CountGood:    calls[0],
 			CountWarning: calls[1],
 			CountBad:     calls[2],
+			Latency:      a.Latency[method],
 		})
 		total += calls[0] + calls[1] + calls[2]
 	}
-	b, err := json.Marshal(sub)
+	return sub, total
+}
+
+// sendBatch submits a, spooling it if that fails and WithSpool is used.
+// It returns whether a failed batch was spooled, batches which weren't are kept by the caller.
+func (c *Client) sendBatch(ctx context.Context, a aggregate) (bool, error) {
+	if len(a.Calls) == 0 {
+		return false, nil
+	}
+
+	sub, total := a.submission()
+	err := c.submit(ctx, sub, total)
 	if err != nil {
-		return err
+		if c.spool == nil {
+			return false, err
+		}
+		if sErr := c.spool.Write(sub); sErr != nil {
+			log.Error(ctx, errors.Wrap(sErr, "failed to spool batch"))
+			return false, err
+		}
+		return true, err
 	}
+	c.replaySpool(ctx)
+	return false, nil
+}
 
-	_, err = c.doRetry(ctx, http.MethodPost, "/gridlock/api/submit", b)
+func (c *Client) submit(ctx context.Context, sub api.SubmitMetrics, total int64) error {
+	t0 := time.Now()
+	err := c.send(ctx, sub)
 	if err != nil {
 		c.metrics.SubmissionErrors.Inc()
 		return err
@@ -331,8 +657,95 @@ func (c *Client) sendBatch(ctx context.Context, a aggregate) error {
 	return nil
 }
 
+func (c *Client) send(ctx context.Context, sub api.SubmitMetrics) error {
+	if c.grpcConn != nil {
+		ctx, cancel := context.WithTimeout(ctx, c.reqTimeout)
+		defer cancel()
+		if c.bearerToken != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.bearerToken)
+		}
+		_, err := gridlockpb.NewGridlockClient(c.grpcConn).SubmitMetrics(ctx, sub.ToProto(), c.grpcCallOptions()...)
+		return err
+	}
+	b, h, err := c.encodeSubmission(sub)
+	if err != nil {
+		return err
+	}
+	c.authenticate(h, b)
+	_, err = c.doRetry(ctx, http.MethodPost, "/gridlock/api/submit", b, h)
+	return err
+}
+
+func (c *Client) authenticate(h http.Header, body []byte) {
+	if c.bearerToken != "" {
+		h.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	if c.hmacKey != nil {
+		ts := time.Now().Unix()
+		h.Set(api.HeaderSignatureTimestamp, strconv.FormatInt(ts, 10))
+		h.Set(api.HeaderSignature, api.SignSubmission(c.hmacKey, ts, body))
+	}
+}
+
+func (c *Client) grpcCallOptions() []grpc.CallOption {
+	var opts []grpc.CallOption
+	if c.gzip {
+		opts = append(opts, grpc.UseCompressor(grpcgzip.Name))
+	}
+	return opts
+}
+
+func (c *Client) encodeSubmission(sub api.SubmitMetrics) ([]byte, http.Header, error) {
+	h := make(http.Header)
+	var b []byte
+	var err error
+	switch c.encoding {
+	case EncodingProto:
+		b, err = proto.Marshal(sub.ToProto())
+		h.Set("Content-Type", api.ContentTypeProto)
+	default:
+		b, err = json.Marshal(sub)
+		h.Set("Content-Type", api.ContentTypeJSON)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.gzip {
+		return b, h, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, nil, errors.Wrap(err, "gzip")
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, errors.Wrap(err, "gzip")
+	}
+	h.Set("Content-Encoding", "gzip")
+	return buf.Bytes(), h, nil
+}
+
+func (c *Client) replaySpool(ctx context.Context) {
+	if c.spool == nil {
+		return
+	}
+	err := c.spool.Replay(ctx, func(sub api.SubmitMetrics) error {
+		var total int64
+		for _, m := range sub.Metrics {
+			total += m.CountGood + m.CountWarning + m.CountBad
+		}
+		return c.submit(ctx, sub, total)
+	})
+	if err != nil {
+		log.Error(ctx, errors.Wrap(err, "failed to replay spooled batches"))
+	}
+}
+
 func (c *Client) GetTraffic(ctx context.Context) ([]api.Traffic, error) {
-	r, err := c.do(ctx, http.MethodGet, "/gridlock/api/traffic", nil)
+	if c.grpcConn != nil {
+		return c.getTrafficGRPC(ctx)
+	}
+	r, err := c.do(ctx, http.MethodGet, "/gridlock/api/traffic", nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -344,3 +757,23 @@ func (c *Client) GetTraffic(ctx context.Context) ([]api.Traffic, error) {
 	}
 	return resp.Traffic, nil
 }
+
+func (c *Client) getTrafficGRPC(ctx context.Context) ([]api.Traffic, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.reqTimeout)
+	defer cancel()
+
+	s, err := gridlockpb.NewGridlockClient(c.grpcConn).GetTraffic(ctx, &gridlockpb.GetTrafficRequest{}, c.grpcCallOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	var ret []api.Traffic
+	for {
+		t, err := s.Recv()
+		if errors.Is(err, io.EOF) {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ret = append(ret, api.TrafficFromProto(t))
+	}
+}
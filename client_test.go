@@ -2,15 +2,29 @@ package gridlock
 
 import (
 	"context"
+	"encoding/json"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/jtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/api/gridlockpb"
+	"github.com/luno/gridlock/api/vizceral"
 	"github.com/luno/gridlock/server/handlers"
 	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/gridlock/server/ops/config"
 )
 
 type state struct {
@@ -63,8 +77,14 @@ func TestClientSubmitsMetrics(t *testing.T) {
 
 	jtest.RequireNil(t, c.Flush(ctx))
 
-	traffic, err := c.GetTraffic(ctx)
-	jtest.RequireNil(t, err)
+	// Submissions are applied to the loaded traffic asynchronously
+	var traffic []api.Traffic
+	require.Eventually(t, func() bool {
+		var err error
+		traffic, err = c.GetTraffic(ctx)
+		jtest.RequireNil(t, err)
+		return len(traffic) == 2
+	}, time.Second, 10*time.Millisecond)
 
 	for i := range traffic {
 		assert.NotZero(t, traffic[i].Ts)
@@ -72,7 +92,439 @@ func TestClientSubmitsMetrics(t *testing.T) {
 	}
 
 	assert.Equal(t, []api.Traffic{
-		{Duration: 60, From: "server1", To: "server2", CountGood: 2, CountBad: 1},
-		{Duration: 60, From: "server2", To: "server1", CountWarning: 1},
+		{Duration: 60, From: "server1", To: "server2", SourceRegion: "region-a", TargetRegion: "region-a", CountGood: 2, CountBad: 1},
+		{Duration: 60, From: "server2", To: "server1", SourceRegion: "region-a", TargetRegion: "region-a", CountWarning: 1},
 	}, traffic)
 }
+
+func TestClientSubmitsLatency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	db := ops.NewMemDB()
+	s := state{Log: ops.NewLoader(ctx, db, db)}
+
+	srv := httptest.NewServer(handlers.CreateRouter(ctx, s))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(
+		WithBaseURL(srv.URL),
+		WithHTTPClient(srv.Client()),
+	)
+
+	go func() {
+		err := c.Deliver(ctx)
+		jtest.Assert(t, context.Canceled, err)
+	}()
+
+	m := Method{
+		Source: "server1", SourceRegion: "region-a",
+		Target: "server2", TargetRegion: "region-a",
+	}
+	for i := 0; i < 98; i++ {
+		c.RecordDuration(m, CallGood, 10*time.Millisecond)
+	}
+	c.RecordDuration(m, CallGood, time.Second)
+	<-c.RecordDuration(m, CallGood, time.Second)
+
+	jtest.RequireNil(t, c.Flush(ctx))
+
+	require.Eventually(t, func() bool {
+		traffic, err := c.GetTraffic(ctx)
+		jtest.RequireNil(t, err)
+		return len(traffic) == 1 && traffic[0].CountGood == 100
+	}, time.Second, 10*time.Millisecond)
+
+	traffic, err := c.GetTraffic(ctx)
+	jtest.RequireNil(t, err)
+	assert.InDelta(t, 0.01, traffic[0].LatencyP50, 0.002)
+	assert.InDelta(t, 1, traffic[0].LatencyP99, 0.5)
+}
+
+func TestClientNonFatalDelivery(t *testing.T) {
+	// A file where the spool's directory should be makes every spool write fail
+	badSpool := filepath.Join(t.TempDir(), "spool")
+	require.NoError(t, os.WriteFile(badSpool, nil, 0o644))
+
+	testCases := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "merged"},
+		{name: "spool fails", opts: []ClientOption{WithSpool(badSpool, time.Hour, 0)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			var mu sync.Mutex
+			failures := 3
+			var received []api.Metrics
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if failures > 0 {
+					failures--
+					http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				var sub api.SubmitMetrics
+				jtest.RequireNil(t, json.NewDecoder(r.Body).Decode(&sub))
+				received = append(received, sub.Metrics...)
+			}))
+			t.Cleanup(srv.Close)
+
+			errs := &counter{}
+			opts := append([]ClientOption{
+				WithBaseURL(srv.URL),
+				WithHTTPClient(srv.Client()),
+				WithFlushPeriod(5 * time.Millisecond),
+				WithNonFatalDelivery(5*time.Millisecond, 20*time.Millisecond),
+				WithMetrics(Metrics{SubmissionErrors: errs}),
+			}, tc.opts...)
+			c := NewClient(opts...)
+			done := make(chan error)
+			go func() {
+				done <- c.Deliver(ctx)
+			}()
+
+			m := Method{Source: "server1", Target: "server2"}
+			for i := 0; i < 5; i++ {
+				<-c.Record(m, CallGood)
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				var total int64
+				for _, r := range received {
+					total += r.CountGood
+				}
+				return total == 5
+			}, time.Second, 5*time.Millisecond)
+
+			assert.Equal(t, float64(3), errs.Value())
+			cancel()
+			jtest.Assert(t, context.Canceled, <-done)
+		})
+	}
+}
+
+func TestClientNonFatalDeliveryBackoff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		min, max time.Duration
+		expPanic bool
+	}{
+		{name: "valid", min: time.Second, max: time.Minute},
+		{name: "fixed", min: time.Second, max: time.Second},
+		{name: "zero", max: time.Minute, expPanic: true},
+		{name: "negative", min: -time.Second, max: time.Minute, expPanic: true},
+		{name: "max below min", min: time.Minute, max: time.Second, expPanic: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			newClient := func() { NewClient(WithNonFatalDelivery(tc.min, tc.max)) }
+			if tc.expPanic {
+				assert.Panics(t, newClient)
+			} else {
+				assert.NotPanics(t, newClient)
+			}
+		})
+	}
+}
+
+type counter struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (c *counter) Inc() { c.Add(1) }
+
+func (c *counter) Add(v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.v += v
+}
+
+func (c *counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v
+}
+
+func TestClientCloseFlushesCalls(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "counters", opts: []ClientOption{WithBackpressure(BackpressureAggregate)}},
+		{name: "queue", opts: []ClientOption{WithBackpressure(BackpressureDrop)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var mu sync.Mutex
+			var received []api.Metrics
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var sub api.SubmitMetrics
+				jtest.RequireNil(t, json.NewDecoder(r.Body).Decode(&sub))
+				mu.Lock()
+				defer mu.Unlock()
+				received = append(received, sub.Metrics...)
+			}))
+			t.Cleanup(srv.Close)
+
+			dropped := &counter{}
+			opts := append([]ClientOption{
+				WithBaseURL(srv.URL),
+				WithHTTPClient(srv.Client()),
+				WithFlushPeriod(time.Hour),
+				WithMetrics(Metrics{DroppedCalls: dropped}),
+			}, tc.opts...)
+			c := NewClient(opts...)
+
+			done := make(chan error)
+			go func() {
+				done <- c.Deliver(ctx)
+			}()
+
+			m := Method{Source: "server1", Target: "server2"}
+			c.Record(m, CallGood)
+			c.Record(m, CallBad)
+
+			jtest.RequireNil(t, c.Close(ctx))
+			jtest.RequireNil(t, <-done)
+
+			mu.Lock()
+			require.Len(t, received, 1)
+			assert.Equal(t, int64(1), received[0].CountGood)
+			assert.Equal(t, int64(1), received[0].CountBad)
+			mu.Unlock()
+
+			c.Record(m, CallGood)
+			assert.Equal(t, float64(1), dropped.Value())
+
+			jtest.Assert(t, ErrClientClosed, c.Close(ctx))
+			jtest.Assert(t, ErrClientClosed, c.Flush(ctx))
+			jtest.Assert(t, ErrClientClosed, c.Deliver(ctx))
+		})
+	}
+}
+
+func TestClientCloseConcurrently(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(WithBaseURL(srv.URL), WithHTTPClient(srv.Client()), WithFlushPeriod(time.Hour))
+	go func() {
+		_ = c.Deliver(ctx)
+	}()
+	<-c.Record(Method{Source: "server1", Target: "server2"}, CallGood)
+
+	const n = 5
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- c.Close(ctx) }()
+		go func() { errs <- c.Flush(ctx) }()
+	}
+
+	var closed int
+	for i := 0; i < 2*n; i++ {
+		err := <-errs
+		if errors.Is(err, ErrClientClosed) {
+			closed++
+			continue
+		}
+		jtest.RequireNil(t, err)
+	}
+	// Only one Close succeeds, Flushes may succeed if they're before it
+	assert.GreaterOrEqual(t, closed, n-1)
+	jtest.Assert(t, ErrClientClosed, c.Flush(ctx))
+}
+
+func TestClientEncodings(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "json"},
+		{name: "gzip json", opts: []ClientOption{WithGzip()}},
+		{name: "proto", opts: []ClientOption{WithEncoding(EncodingProto)}},
+		{name: "gzip proto", opts: []ClientOption{WithEncoding(EncodingProto), WithGzip()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			db := ops.NewMemDB()
+			s := state{Log: ops.NewLoader(ctx, db, db)}
+
+			srv := httptest.NewServer(handlers.CreateRouter(ctx, s))
+			t.Cleanup(srv.Close)
+
+			opts := append([]ClientOption{
+				WithBaseURL(srv.URL),
+				WithHTTPClient(srv.Client()),
+			}, tc.opts...)
+			c := NewClient(opts...)
+			go func() {
+				_ = c.Deliver(ctx)
+			}()
+
+			<-c.RecordDuration(Method{Source: "server1", Target: "server2"}, CallGood, time.Millisecond)
+			jtest.RequireNil(t, c.Flush(ctx))
+
+			require.Eventually(t, func() bool {
+				traffic, err := c.GetTraffic(ctx)
+				jtest.RequireNil(t, err)
+				return len(traffic) == 1 && traffic[0].CountGood == 1 && traffic[0].LatencyP50 > 0
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func startGRPCServer(t *testing.T, d handlers.Deps) *grpc.ClientConn {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	jtest.RequireNil(t, err)
+	srv := grpc.NewServer(handlers.GRPCServerOptions()...)
+	handlers.RegisterGRPCService(srv, d)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	jtest.RequireNil(t, err)
+	t.Cleanup(func() { _ = cc.Close() })
+	return cc
+}
+
+func TestClientGRPCTransport(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "plain"},
+		{name: "gzip", opts: []ClientOption{WithGzip()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			db := ops.NewMemDB()
+			s := state{Log: ops.NewLoader(ctx, db, db)}
+			cc := startGRPCServer(t, s)
+
+			c := NewClient(append([]ClientOption{WithGRPCConn(cc)}, tc.opts...)...)
+			go func() {
+				_ = c.Deliver(ctx)
+			}()
+
+			c.RecordDuration(Method{Source: "server1", Target: "server2"}, CallGood, time.Millisecond)
+			<-c.Record(Method{Source: "server1", Target: "server2"}, CallBad)
+			jtest.RequireNil(t, c.Flush(ctx))
+
+			require.Eventually(t, func() bool {
+				traffic, err := c.GetTraffic(ctx)
+				jtest.RequireNil(t, err)
+				return len(traffic) == 1 && traffic[0].CountGood == 1 && traffic[0].CountBad == 1
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestGRPCWatchGraph(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	db := ops.NewMemDB()
+	s := state{Log: ops.NewLoader(ctx, db, db)}
+	cc := startGRPCServer(t, s)
+
+	jtest.RequireNil(t, s.Log.Record(ctx, api.Metrics{
+		Source: "server1", SourceRegion: "region-a", SourceType: api.NodeService,
+		Target: "server2", TargetRegion: "region-a", TargetType: api.NodeService,
+		Timestamp: time.Now().Unix(), Duration: time.Minute, CountGood: 60,
+	}))
+
+	stream, err := gridlockpb.NewGridlockClient(cc).WatchGraph(ctx,
+		&gridlockpb.WatchGraphRequest{Interval: int64(time.Second)})
+	jtest.RequireNil(t, err)
+
+	// The first graph is sent straight away and then again every interval
+	for i := 0; i < 2; i++ {
+		msg, err := stream.Recv()
+		jtest.RequireNil(t, err)
+		g := vizceral.NodeFromProto(msg)
+		assert.Equal(t, "edge", g.Name)
+		assert.NotEmpty(t, g.Nodes)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	config.SetConfig(config.Config{Auth: config.Auth{
+		BearerTokens: []string{"token"},
+		HMACKeys:     []string{"key"},
+	}})
+	t.Cleanup(func() { config.SetConfig(config.Config{}) })
+
+	testCases := []struct {
+		name      string
+		grpc      bool
+		opts      []ClientOption
+		expReject bool
+	}{
+		{name: "no credentials", expReject: true},
+		{name: "bearer token", opts: []ClientOption{WithBearerToken("token")}},
+		{name: "wrong bearer token", opts: []ClientOption{WithBearerToken("nope")}, expReject: true},
+		{name: "hmac", opts: []ClientOption{WithHMACKey([]byte("key"))}},
+		{name: "gzip hmac", opts: []ClientOption{WithHMACKey([]byte("key")), WithGzip()}},
+		{name: "wrong hmac key", opts: []ClientOption{WithHMACKey([]byte("nope"))}, expReject: true},
+		{name: "grpc no credentials", grpc: true, expReject: true},
+		{name: "grpc bearer token", grpc: true, opts: []ClientOption{WithBearerToken("token")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			db := ops.NewMemDB()
+			s := state{Log: ops.NewLoader(ctx, db, db)}
+
+			opts := tc.opts
+			if tc.grpc {
+				opts = append(opts, WithGRPCConn(startGRPCServer(t, s)))
+			} else {
+				srv := httptest.NewServer(handlers.CreateRouter(ctx, s))
+				t.Cleanup(srv.Close)
+				opts = append(opts, WithBaseURL(srv.URL), WithHTTPClient(srv.Client()))
+			}
+			c := NewClient(opts...)
+			go func() {
+				_ = c.Deliver(ctx)
+			}()
+
+			<-c.Record(Method{Source: "server1", Target: "server2"}, CallGood)
+			err := c.Flush(ctx)
+			if tc.expReject {
+				require.Error(t, err)
+				return
+			}
+			jtest.RequireNil(t, err)
+			require.Eventually(t, func() bool {
+				traffic, err := c.GetTraffic(ctx)
+				jtest.RequireNil(t, err)
+				return len(traffic) == 1
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package gridlock
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luno/gridlock/api"
+)
+
+const (
+	counterStripes = 8
+	// counterIdleDrains is how many drains in a row a Method can go without calls
+	// before its counters are evicted
+	counterIdleDrains = 3
+)
+
+// callCounters accumulates calls for a single Method,
+// counts are striped so that concurrent callers rarely touch the same cache line
+type callCounters struct {
+	stripes [counterStripes]counterStripe
+	// evicted is set once the counters are removed from the counterMap
+	evicted atomic.Bool
+	// idle is the number of drains in a row which found nothing, only used by DrainInto
+	idle int
+}
+
+type counterStripe struct {
+	calls   [3]atomic.Int64
+	latency [api.HistogramBuckets]atomic.Int64
+	// Keep neighbouring stripes off the same cache line
+	_ [64]byte
+}
+
+func (c *callCounters) record(call incCall) {
+	s := &c.stripes[rand.Uint32()%counterStripes]
+	switch call.Success {
+	case CallGood:
+		s.calls[0].Add(1)
+	case CallWarning:
+		s.calls[1].Add(1)
+	case CallBad:
+		s.calls[2].Add(1)
+	}
+	if call.Timed {
+		s.latency[api.HistogramBucket(call.Duration)].Add(1)
+	}
+}
+
+// drain swaps out the counters, returning what had been recorded
+func (c *callCounters) drain() (CallAggregate, api.Histogram) {
+	var calls CallAggregate
+	var h api.Histogram
+	for si := range c.stripes {
+		s := &c.stripes[si]
+		for i := range s.calls {
+			calls[i] += s.calls[i].Swap(0)
+		}
+		for i := range s.latency {
+			if n := s.latency[i].Swap(0); n != 0 {
+				h = h.Add(api.HistogramBound(i), n)
+			}
+		}
+	}
+	return calls, h
+}
+
+// add puts back counts drained from another callCounters
+func (c *callCounters) add(calls CallAggregate, h api.Histogram) {
+	s := &c.stripes[rand.Uint32()%counterStripes]
+	for i := range calls {
+		if calls[i] != 0 {
+			s.calls[i].Add(calls[i])
+		}
+	}
+	for i, n := range h {
+		if n != 0 {
+			s.latency[i].Add(n)
+		}
+	}
+}
+
+// counterMap holds callCounters for each Method without taking a lock to record,
+// it is a copy-on-write map which only locks when a Method is added or evicted.
+// Methods which go counterIdleDrains drains without calls are evicted,
+// so that the map doesn't grow with every Method ever recorded.
+type counterMap struct {
+	mu sync.Mutex
+	m  atomic.Pointer[map[Method]*callCounters]
+}
+
+func newCounterMap() *counterMap {
+	return &counterMap{}
+}
+
+func (m *counterMap) get(k Method) *callCounters {
+	cur := m.m.Load()
+	if cur != nil {
+		if c, ok := (*cur)[k]; ok {
+			return c
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur = m.m.Load()
+	if cur != nil {
+		if c, ok := (*cur)[k]; ok {
+			return c
+		}
+	}
+	next := make(map[Method]*callCounters)
+	if cur != nil {
+		for method, c := range *cur {
+			next[method] = c
+		}
+	}
+	c := new(callCounters)
+	next[k] = c
+	m.m.Store(&next)
+	return c
+}
+
+func (m *counterMap) Record(call incCall) {
+	c := m.get(call.M)
+	c.record(call)
+	if c.evicted.Load() {
+		// The counters were evicted while we were recording,
+		// move whatever wasn't drained into the current ones
+		calls, h := c.drain()
+		m.get(call.M).add(calls, h)
+	}
+}
+
+// DrainInto moves every recorded call into agg and evicts idle Methods
+func (m *counterMap) DrainInto(agg aggregate) {
+	cur := m.m.Load()
+	if cur == nil {
+		return
+	}
+	var idle []Method
+	for method, c := range *cur {
+		calls, h := c.drain()
+		if calls == (CallAggregate{}) && len(h) == 0 {
+			c.idle++
+			if c.idle >= counterIdleDrains {
+				idle = append(idle, method)
+			}
+			continue
+		}
+		c.idle = 0
+		addCalls(agg, method, calls, h)
+	}
+	if len(idle) > 0 {
+		m.evict(agg, idle)
+	}
+}
+
+// evict removes methods from the map, anything recorded for them since they were drained is moved into agg
+func (m *counterMap) evict(agg aggregate, methods []Method) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur := m.m.Load()
+	next := make(map[Method]*callCounters, len(*cur))
+	for method, c := range *cur {
+		next[method] = c
+	}
+	var evicted []*callCounters
+	for _, method := range methods {
+		evicted = append(evicted, next[method])
+		delete(next, method)
+	}
+	m.m.Store(&next)
+
+	for i, c := range evicted {
+		c.evicted.Store(true)
+		calls, h := c.drain()
+		addCalls(agg, methods[i], calls, h)
+	}
+}
+
+func addCalls(agg aggregate, method Method, calls CallAggregate, h api.Histogram) {
+	if calls != (CallAggregate{}) {
+		l := agg.Calls[method]
+		for i := range l {
+			l[i] += calls[i]
+		}
+		agg.Calls[method] = l
+	}
+	if len(h) > 0 {
+		agg.Latency[method] = agg.Latency[method].Merge(h)
+	}
+}
+
+// Backpressure controls what Record does when calls are recorded faster than they can be aggregated
+type Backpressure int
+
+const (
+	// BackpressureDrop drops calls when the queue is full
+	BackpressureDrop Backpressure = 0
+	// BackpressureBlock waits for space in the queue, up to the block timeout
+	BackpressureBlock Backpressure = 1
+	// BackpressureAggregate skips the queue and counts calls directly,
+	// calls are never dropped. This is the default.
+	BackpressureAggregate Backpressure = 2
+)
+
+func WithBackpressure(b Backpressure) ClientOption {
+	return func(client *Client) {
+		client.backpressure = b
+	}
+}
+
+// WithBlockTimeout sets how long BackpressureBlock waits before dropping a call
+func WithBlockTimeout(d time.Duration) ClientOption {
+	return func(client *Client) {
+		client.blockTimeout = d
+	}
+}
+
+// WithQueueSize sets how many calls can be waiting to be aggregated,
+// the queue is only used by BackpressureDrop and BackpressureBlock
+func WithQueueSize(n int) ClientOption {
+	return func(client *Client) {
+		client.queueSize = n
+	}
+}
@@ -0,0 +1,198 @@
+package gridlock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestBackpressure(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       []ClientOption
+		expDropped float64
+	}{
+		{name: "drop", opts: []ClientOption{WithBackpressure(BackpressureDrop)}, expDropped: 2},
+		{
+			name: "block",
+			opts: []ClientOption{
+				WithBackpressure(BackpressureBlock),
+				WithBlockTimeout(time.Millisecond),
+			},
+			expDropped: 2,
+		},
+		{name: "aggregate", opts: []ClientOption{WithBackpressure(BackpressureAggregate)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dropped := &counter{}
+			opts := append([]ClientOption{
+				WithQueueSize(1),
+				WithMetrics(Metrics{DroppedCalls: dropped}),
+			}, tc.opts...)
+			c := NewClient(opts...)
+			for i := 0; i < 3; i++ {
+				c.Record(Method{Source: "a", Target: "b"}, CallGood)
+			}
+			assert.Equal(t, tc.expDropped, dropped.Value())
+		})
+	}
+}
+
+// queuedClient creates a client which leaves recorded calls in its queue, where tests can read them
+func queuedClient(opts ...ClientOption) *Client {
+	return NewClient(append([]ClientOption{WithBackpressure(BackpressureDrop)}, opts...)...)
+}
+
+func TestBlockingRecordWaitsForQueue(t *testing.T) {
+	c := NewClient(
+		WithQueueSize(1),
+		WithBackpressure(BackpressureBlock),
+		WithBlockTimeout(time.Second),
+	)
+	c.Record(Method{}, CallGood)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-c.q
+	}()
+	done := c.Record(Method{}, CallBad)
+	select {
+	case <-done:
+		t.Fatal("call should be queued")
+	default:
+	}
+	call := <-c.q
+	assert.Equal(t, CallBad, call.Success)
+}
+
+func TestCounterMap(t *testing.T) {
+	m := newCounterMap()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Record(incCall{
+					M:        Method{Source: "a", Target: string(rune('a' + j%4))},
+					Success:  CallSuccess(1 + i%3),
+					Duration: time.Millisecond,
+					Timed:    j%2 == 0,
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	agg := newAggregate(time.Now())
+	m.DrainInto(agg)
+	assert.Len(t, agg.Calls, 4)
+	var total int64
+	var timed int64
+	for method, calls := range agg.Calls {
+		total += calls[0] + calls[1] + calls[2]
+		timed += agg.Latency[method].Count()
+	}
+	assert.Equal(t, int64(8000), total)
+	assert.Equal(t, int64(4000), timed)
+	assert.Equal(t, CallAggregate{750, 750, 500}, agg.Calls[Method{Source: "a", Target: "a"}])
+	assert.Equal(t, api.HistogramBucket(time.Millisecond)+1, len(agg.Latency[Method{Source: "a", Target: "a"}]))
+
+	agg = newAggregate(time.Now())
+	m.DrainInto(agg)
+	assert.Empty(t, agg.Calls)
+}
+
+func TestCounterMapEvictsIdleMethods(t *testing.T) {
+	m := newCounterMap()
+	busy := Method{Source: "a", Target: "b"}
+	idle := Method{Source: "a", Target: "c"}
+	m.Record(incCall{M: busy, Success: CallGood})
+	m.Record(incCall{M: idle, Success: CallGood})
+
+	for i := 0; i <= counterIdleDrains; i++ {
+		agg := newAggregate(time.Now())
+		m.DrainInto(agg)
+		m.Record(incCall{M: busy, Success: CallGood})
+	}
+	assert.Len(t, *m.m.Load(), 1)
+	assert.Contains(t, *m.m.Load(), busy)
+}
+
+func TestCounterMapKeepsCallsWhileEvicting(t *testing.T) {
+	m := newCounterMap()
+	total := newAggregate(time.Now())
+
+	stop := make(chan struct{})
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			m.DrainInto(total)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Record(incCall{M: Method{Source: "a", Target: string(rune('a' + (i+j)%16))}, Success: CallGood})
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-drained
+	m.DrainInto(total)
+
+	var n int64
+	for _, calls := range total.Calls {
+		n += calls[0]
+	}
+	assert.Equal(t, int64(8000), n)
+}
+
+func BenchmarkRecord(b *testing.B) {
+	m := Method{
+		Source: "server1", SourceRegion: "region-a",
+		Target: "server2", TargetRegion: "region-a",
+	}
+	benchmarks := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "queue", opts: []ClientOption{WithBackpressure(BackpressureDrop), WithQueueSize(1 << 20)}},
+		{name: "counters", opts: []ClientOption{WithBackpressure(BackpressureAggregate)}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			c := NewClient(bm.opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				_ = c.Deliver(ctx)
+			}()
+
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c.RecordDuration(m, CallGood, time.Millisecond)
+				}
+			})
+		})
+	}
+}
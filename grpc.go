@@ -2,31 +2,266 @@ package gridlock
 
 import (
 	"context"
+	"io"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-func GRPCClientReporter(c Client) grpc.UnaryClientInterceptor {
+const (
+	DefaultSourceMetadataKey       = "gridlock-source"
+	DefaultSourceRegionMetadataKey = "gridlock-source-region"
+)
+
+type grpcOptions struct {
+	sourceKey       string
+	sourceRegionKey string
+	countMessages   bool
+	classify        GRPCClassifier
+}
+
+type GRPCOption func(*grpcOptions)
+
+// WithSourceMetadataKey sets the metadata keys used to identify the calling service,
+// clients will send them and servers will read them
+func WithSourceMetadataKey(sourceKey, sourceRegionKey string) GRPCOption {
+	return func(o *grpcOptions) {
+		o.sourceKey = sourceKey
+		o.sourceRegionKey = sourceRegionKey
+	}
+}
+
+// WithMessageCounting makes stream reporters record a call for
+// every message sent and received, in addition to the stream itself
+func WithMessageCounting() GRPCOption {
+	return func(o *grpcOptions) {
+		o.countMessages = true
+	}
+}
+
+// WithGRPCClassifier overrides DefaultGRPCClassifier for reporting call results
+func WithGRPCClassifier(f GRPCClassifier) GRPCOption {
+	return func(o *grpcOptions) {
+		o.classify = f
+	}
+}
+
+func resolveGRPCOptions(opts []GRPCOption) grpcOptions {
+	o := grpcOptions{
+		sourceKey:       DefaultSourceMetadataKey,
+		sourceRegionKey: DefaultSourceRegionMetadataKey,
+		classify:        DefaultGRPCClassifier,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func GRPCClientReporter(c *Client, opts ...GRPCOption) grpc.UnaryClientInterceptor {
+	o := resolveGRPCOptions(opts)
 	return func(ctx context.Context,
 		method string, req, reply interface{},
 		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
 		opts ...grpc.CallOption,
 	) error {
+		ctx = o.appendSource(ctx, c.defaultMethod)
+		t0 := time.Now()
 		err := invoker(ctx, method, req, reply, cc, opts...)
 
-		success := CallGood
+		service, _ := splitMethodName(method)
+		c.RecordDuration(Method{Target: service, Transport: api.TransportGRPC}, o.result(err), time.Since(t0))
+
+		return err
+	}
+}
+
+// GRPCStreamClientReporter records outbound streams when they end,
+// a stream which finishes with io.EOF is considered successful.
+// Streams which are abandoned are recorded when ctx is done.
+func GRPCStreamClientReporter(c *Client, opts ...GRPCOption) grpc.StreamClientInterceptor {
+	o := resolveGRPCOptions(opts)
+	return func(ctx context.Context,
+		desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		ctx = o.appendSource(ctx, c.defaultMethod)
+		service, _ := splitMethodName(method)
+		m := Method{Target: service, Transport: api.TransportGRPC}
+
+		t0 := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
 		if err != nil {
-			success = CallBad
+			c.RecordDuration(m, o.result(err), time.Since(t0))
+			return nil, err
 		}
-		service, _ := splitMethodName(method)
-		c.Record(Method{Target: service, Transport: api.TransportGRPC}, success)
+		s := &reportingClientStream{
+			ClientStream:  cs,
+			c:             c,
+			m:             m,
+			started:       t0,
+			serverStreams: desc.ServerStreams,
+			countMessages: o.countMessages,
+			result:        o.result,
+			done:          make(chan struct{}),
+		}
+		go s.finishWhenDone(ctx)
+		return s, nil
+	}
+}
+
+type reportingClientStream struct {
+	grpc.ClientStream
+
+	c             *Client
+	m             Method
+	started       time.Time
+	serverStreams bool
+	countMessages bool
+	result        func(error) CallSuccess
+	once          sync.Once
+	done          chan struct{}
+}
+
+func (s *reportingClientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.finish(err)
+	}
+	return md, err
+}
+
+func (s *reportingClientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *reportingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil && s.countMessages {
+		s.c.Record(s.m, CallGood)
+	}
+	return err
+}
+
+func (s *reportingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.finish(err)
+		return err
+	}
+	if s.countMessages {
+		s.c.Record(s.m, CallGood)
+	}
+	if !s.serverStreams {
+		// Client streams only receive a single response
+		s.finish(nil)
+	}
+	return nil
+}
+
+func (s *reportingClientStream) finish(err error) {
+	s.once.Do(func() {
+		s.c.RecordDuration(s.m, s.result(err), time.Since(s.started))
+		close(s.done)
+	})
+}
+
+// finishWhenDone records streams which are cancelled before they're received to the end
+func (s *reportingClientStream) finishWhenDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		s.finish(status.FromContextError(ctx.Err()).Err())
+	case <-s.done:
+	}
+}
+
+// result classifies the error returned from a call or stream,
+// streams which finish with io.EOF have completed successfully
+func (o grpcOptions) result(err error) CallSuccess {
+	if errors.Is(err, io.EOF) {
+		return CallGood
+	}
+	return o.classify(status.Code(err))
+}
+
+// GRPCServerReporter records inbound unary calls, the caller is identified
+// by the metadata it sends and the local service is taken from the client's default method
+func GRPCServerReporter(c *Client, opts ...GRPCOption) grpc.UnaryServerInterceptor {
+	o := resolveGRPCOptions(opts)
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		t0 := time.Now()
+		resp, err := handler(ctx, req)
+
+		m := o.inboundMethod(ctx, c.defaultMethod, info.FullMethod)
+		c.recordInbound(m, o.result(err), time.Since(t0))
+
+		return resp, err
+	}
+}
+
+// GRPCStreamServerReporter records inbound streams once the handler returns
+func GRPCStreamServerReporter(c *Client, opts ...GRPCOption) grpc.StreamServerInterceptor {
+	o := resolveGRPCOptions(opts)
+	return func(srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		t0 := time.Now()
+		err := handler(srv, ss)
+
+		m := o.inboundMethod(ss.Context(), c.defaultMethod, info.FullMethod)
+		c.recordInbound(m, o.result(err), time.Since(t0))
 
 		return err
 	}
 }
 
+func (o grpcOptions) appendSource(ctx context.Context, local Method) context.Context {
+	var kv []string
+	if local.Source != "" {
+		kv = append(kv, o.sourceKey, local.Source)
+	}
+	if local.SourceRegion != "" {
+		kv = append(kv, o.sourceRegionKey, local.SourceRegion)
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+func (o grpcOptions) inboundMethod(ctx context.Context, local Method, fullMethod string) Method {
+	md, _ := metadata.FromIncomingContext(ctx)
+	m := inboundMethod(local,
+		firstValue(md.Get(o.sourceKey)),
+		firstValue(md.Get(o.sourceRegionKey)),
+		api.TransportGRPC,
+	)
+	if m.Target == "" {
+		m.Target, _ = splitMethodName(fullMethod)
+	}
+	return m
+}
+
+func firstValue(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
 func splitMethodName(fullMethodName string) (string, string) {
 	fullMethodName = strings.TrimPrefix(fullMethodName, "/") // remove leading slash
 	if i := strings.Index(fullMethodName, "/"); i >= 0 {
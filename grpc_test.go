@@ -0,0 +1,305 @@
+package gridlock
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestGRPCServerReporter(t *testing.T) {
+	testCases := []struct {
+		name      string
+		md        metadata.MD
+		opts      []GRPCOption
+		handleErr error
+		expMethod Method
+		expResult CallSuccess
+	}{
+		{
+			name: "source from metadata",
+			md:   metadata.Pairs(DefaultSourceMetadataKey, "caller", DefaultSourceRegionMetadataKey, "region-b"),
+			expMethod: Method{
+				Source: "caller", SourceRegion: "region-b",
+				Target: "local", TargetRegion: "region-a", TargetType: api.NodeService,
+				Transport: api.TransportGRPC,
+			},
+			expResult: CallGood,
+		},
+		{
+			name: "custom metadata key",
+			md:   metadata.Pairs("x-service", "caller"),
+			opts: []GRPCOption{WithSourceMetadataKey("x-service", "x-region")},
+			expMethod: Method{
+				Source: "caller",
+				Target: "local", TargetRegion: "region-a", TargetType: api.NodeService,
+				Transport: api.TransportGRPC,
+			},
+			expResult: CallGood,
+		},
+		{
+			name:      "unknown caller",
+			handleErr: status.Error(codes.Unavailable, ""),
+			expMethod: Method{
+				Source: "unknown",
+				Target: "local", TargetRegion: "region-a", TargetType: api.NodeService,
+				Transport: api.TransportGRPC,
+			},
+			expResult: CallBad,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := queuedClient(WithDefaultMethod(Method{
+				Source: "local", SourceRegion: "region-a", SourceType: api.NodeService,
+			}))
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+
+			intercept := GRPCServerReporter(c, tc.opts...)
+			_, err := intercept(ctx, nil,
+				&grpc.UnaryServerInfo{FullMethod: "/local.Service/Call"},
+				func(context.Context, interface{}) (interface{}, error) {
+					return nil, tc.handleErr
+				},
+			)
+			assert.Equal(t, tc.handleErr, err)
+
+			call := <-c.q
+			assert.Equal(t, tc.expMethod, call.M)
+			assert.Equal(t, tc.expResult, call.Success)
+		})
+	}
+}
+
+func TestGRPCClientReporterSendsSource(t *testing.T) {
+	c := queuedClient(WithDefaultMethod(Method{Source: "local", SourceRegion: "region-a"}))
+	intercept := GRPCClientReporter(c)
+
+	var md metadata.MD
+	err := intercept(context.Background(), "/remote.Service/Call", nil, nil, nil,
+		func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			md, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"local"}, md.Get(DefaultSourceMetadataKey))
+	assert.Equal(t, []string{"region-a"}, md.Get(DefaultSourceRegionMetadataKey))
+
+	call := <-c.q
+	assert.Equal(t, "remote.Service", call.M.Target)
+	assert.Equal(t, CallGood, call.Success)
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	recv      []error
+	headerErr error
+	closeErr  error
+}
+
+func (s *fakeClientStream) SendMsg(interface{}) error { return nil }
+
+func (s *fakeClientStream) Header() (metadata.MD, error) { return nil, s.headerErr }
+
+func (s *fakeClientStream) CloseSend() error { return s.closeErr }
+
+func (s *fakeClientStream) RecvMsg(interface{}) error {
+	err := s.recv[0]
+	s.recv = s.recv[1:]
+	return err
+}
+
+func TestGRPCStreamClientReporter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       []GRPCOption
+		desc       grpc.StreamDesc
+		recv       []error
+		expResults []CallSuccess
+	}{
+		{
+			name:       "server stream ends with eof",
+			desc:       grpc.StreamDesc{ServerStreams: true},
+			recv:       []error{nil, nil, io.EOF},
+			expResults: []CallSuccess{CallGood},
+		},
+		{
+			name:       "server stream fails",
+			desc:       grpc.StreamDesc{ServerStreams: true},
+			recv:       []error{nil, status.Error(codes.Internal, "")},
+			expResults: []CallSuccess{CallBad},
+		},
+		{
+			name:       "server stream not found",
+			desc:       grpc.StreamDesc{ServerStreams: true},
+			recv:       []error{status.Error(codes.NotFound, "")},
+			expResults: []CallSuccess{CallWarning},
+		},
+		{
+			name:       "client stream single response",
+			desc:       grpc.StreamDesc{ClientStreams: true},
+			recv:       []error{nil},
+			expResults: []CallSuccess{CallGood},
+		},
+		{
+			name:       "count messages",
+			opts:       []GRPCOption{WithMessageCounting()},
+			desc:       grpc.StreamDesc{ServerStreams: true, ClientStreams: true},
+			recv:       []error{nil, io.EOF},
+			expResults: []CallSuccess{CallGood, CallGood, CallGood},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := queuedClient()
+			intercept := GRPCStreamClientReporter(c, tc.opts...)
+
+			cs, err := intercept(context.Background(), &tc.desc, nil, "/remote.Service/Stream",
+				func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+					return &fakeClientStream{recv: tc.recv}, nil
+				},
+			)
+			assert.NoError(t, err)
+
+			if tc.desc.ClientStreams {
+				assert.NoError(t, cs.SendMsg(nil))
+			}
+			for range tc.recv {
+				_ = cs.RecvMsg(nil)
+			}
+			// The end of the stream is only recorded once
+			assert.Len(t, c.q, len(tc.expResults))
+
+			for _, exp := range tc.expResults {
+				call := <-c.q
+				assert.Equal(t, "remote.Service", call.M.Target)
+				assert.Equal(t, exp, call.Success)
+			}
+		})
+	}
+}
+
+func TestGRPCStreamClientReporterEnds(t *testing.T) {
+	testCases := []struct {
+		name      string
+		stream    fakeClientStream
+		end       func(cs grpc.ClientStream, cancel context.CancelFunc)
+		expResult CallSuccess
+	}{
+		{
+			name: "cancelled",
+			end: func(_ grpc.ClientStream, cancel context.CancelFunc) {
+				cancel()
+			},
+			expResult: CallWarning,
+		},
+		{
+			name:   "header fails",
+			stream: fakeClientStream{headerErr: status.Error(codes.Unavailable, "")},
+			end: func(cs grpc.ClientStream, _ context.CancelFunc) {
+				_, _ = cs.Header()
+			},
+			expResult: CallBad,
+		},
+		{
+			name:   "close send fails",
+			stream: fakeClientStream{closeErr: status.Error(codes.Internal, "")},
+			end: func(cs grpc.ClientStream, _ context.CancelFunc) {
+				_ = cs.CloseSend()
+			},
+			expResult: CallBad,
+		},
+		{
+			name:   "cancelled after eof",
+			stream: fakeClientStream{recv: []error{io.EOF}},
+			end: func(cs grpc.ClientStream, cancel context.CancelFunc) {
+				_ = cs.RecvMsg(nil)
+				cancel()
+			},
+			expResult: CallGood,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			c := queuedClient()
+			intercept := GRPCStreamClientReporter(c)
+			cs, err := intercept(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/remote.Service/Stream",
+				func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+					return &tc.stream, nil
+				},
+			)
+			assert.NoError(t, err)
+
+			tc.end(cs, cancel)
+
+			call := <-c.q
+			assert.Equal(t, "remote.Service", call.M.Target)
+			assert.Equal(t, tc.expResult, call.Success)
+
+			// Ending the stream again isn't recorded
+			cancel()
+			_, _ = cs.Header()
+			_ = cs.CloseSend()
+			assert.Empty(t, c.q)
+		})
+	}
+}
+
+func TestGRPCClassifier(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      []GRPCOption
+		err       error
+		expResult CallSuccess
+	}{
+		{name: "ok", expResult: CallGood},
+		{name: "caller error", err: status.Error(codes.InvalidArgument, ""), expResult: CallWarning},
+		{name: "server error", err: status.Error(codes.Unavailable, ""), expResult: CallBad},
+		{name: "non status error", err: io.ErrUnexpectedEOF, expResult: CallBad},
+		{
+			name: "custom classifier",
+			opts: []GRPCOption{WithGRPCClassifier(func(code codes.Code) CallSuccess {
+				if code == codes.Unavailable {
+					return CallWarning
+				}
+				return DefaultGRPCClassifier(code)
+			})},
+			err:       status.Error(codes.Unavailable, ""),
+			expResult: CallWarning,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := queuedClient()
+			intercept := GRPCClientReporter(c, tc.opts...)
+			err := intercept(context.Background(), "/remote.Service/Call", nil, nil, nil,
+				func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+					return tc.err
+				},
+			)
+			assert.Equal(t, tc.err, err)
+			call := <-c.q
+			assert.Equal(t, tc.expResult, call.Success)
+		})
+	}
+}
+
+func TestDefaultHTTPClassifier(t *testing.T) {
+	assert.Equal(t, CallGood, DefaultHTTPClassifier(http.StatusOK))
+	assert.Equal(t, CallGood, DefaultHTTPClassifier(http.StatusNotModified))
+	assert.Equal(t, CallWarning, DefaultHTTPClassifier(http.StatusNotFound))
+	assert.Equal(t, CallBad, DefaultHTTPClassifier(http.StatusBadGateway))
+	assert.Equal(t, CallBad, DefaultHTTPClassifier(0))
+}
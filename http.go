@@ -0,0 +1,166 @@
+package gridlock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+)
+
+type httpOptions struct {
+	sourceHeader       string
+	sourceRegionHeader string
+	classify           HTTPClassifier
+}
+
+type HTTPOption func(*httpOptions)
+
+// WithSourceHeader sets the headers used to identify the calling service,
+// transports will send them and handlers will read them
+func WithSourceHeader(sourceHeader, sourceRegionHeader string) HTTPOption {
+	return func(o *httpOptions) {
+		o.sourceHeader = sourceHeader
+		o.sourceRegionHeader = sourceRegionHeader
+	}
+}
+
+// WithHTTPClassifier overrides DefaultHTTPClassifier for reporting call results
+func WithHTTPClassifier(f HTTPClassifier) HTTPOption {
+	return func(o *httpOptions) {
+		o.classify = f
+	}
+}
+
+func resolveHTTPOptions(opts []HTTPOption) httpOptions {
+	o := httpOptions{
+		sourceHeader:       DefaultSourceMetadataKey,
+		sourceRegionHeader: DefaultSourceRegionMetadataKey,
+		classify:           DefaultHTTPClassifier,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// HTTPTransportReporter wraps rt to record outbound requests against the target host,
+// http.DefaultTransport is used when rt is nil
+func HTTPTransportReporter(c *Client, rt http.RoundTripper, opts ...HTTPOption) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &reportingTransport{
+		c:    c,
+		rt:   rt,
+		opts: resolveHTTPOptions(opts),
+	}
+}
+
+type reportingTransport struct {
+	c    *Client
+	rt   http.RoundTripper
+	opts httpOptions
+}
+
+func (t *reportingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	local := t.c.defaultMethod
+	if local.Source != "" || local.SourceRegion != "" {
+		// RoundTrippers must not modify the request
+		req = req.Clone(req.Context())
+		if local.Source != "" {
+			req.Header.Set(t.opts.sourceHeader, local.Source)
+		}
+		if local.SourceRegion != "" {
+			req.Header.Set(t.opts.sourceRegionHeader, local.SourceRegion)
+		}
+	}
+
+	t0 := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+
+	m := Method{Target: req.URL.Hostname(), Transport: api.TransportHTTP}
+	if err != nil {
+		success := CallBad
+		if errors.Is(err, context.Canceled) {
+			success = CallWarning
+		}
+		t.c.RecordDuration(m, success, time.Since(t0))
+		return nil, err
+	}
+	t.c.RecordDuration(m, t.opts.classify(resp.StatusCode), time.Since(t0))
+	return resp, nil
+}
+
+// HTTPHandlerReporter wraps h to record inbound requests,
+// the caller is identified by the headers it sends
+func HTTPHandlerReporter(c *Client, h http.Handler, opts ...HTTPOption) http.Handler {
+	o := resolveHTTPOptions(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		t0 := time.Now()
+		h.ServeHTTP(sw, r)
+
+		m := inboundMethod(c.defaultMethod,
+			r.Header.Get(o.sourceHeader),
+			r.Header.Get(o.sourceRegionHeader),
+			api.TransportHTTP,
+		)
+		if m.Target == "" {
+			m.Target = hostname(r.Host)
+		}
+		c.recordInbound(m, o.classify(sw.Status()), time.Since(t0))
+	})
+}
+
+func hostname(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status sent to the caller,
+// handlers which don't write anything respond with 200
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
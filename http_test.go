@@ -0,0 +1,68 @@
+package gridlock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestHTTPReporters(t *testing.T) {
+	server := queuedClient(WithDefaultMethod(Method{Source: "server", SourceRegion: "region-a"}))
+	handler := HTTPHandlerReporter(server, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := queuedClient(WithDefaultMethod(Method{Source: "client", SourceRegion: "region-b"}))
+	cli := &http.Client{Transport: HTTPTransportReporter(client, nil)}
+
+	resp, err := cli.Get(srv.URL + "/found")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	resp, err = cli.Get(srv.URL + "/missing")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	out := <-client.q
+	assert.Equal(t, Method{
+		Source: "client", SourceRegion: "region-b",
+		Target: "127.0.0.1", Transport: api.TransportHTTP,
+	}, out.M)
+	assert.Equal(t, CallGood, out.Success)
+	out = <-client.q
+	assert.Equal(t, CallWarning, out.Success)
+
+	in := <-server.q
+	assert.Equal(t, Method{
+		Source: "client", SourceRegion: "region-b",
+		Target: "server", TargetRegion: "region-a",
+		Transport: api.TransportHTTP,
+	}, in.M)
+	assert.Equal(t, CallGood, in.Success)
+	in = <-server.q
+	assert.Equal(t, CallWarning, in.Success)
+}
+
+func TestHTTPTransportReporterError(t *testing.T) {
+	c := queuedClient()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	cli := &http.Client{Transport: HTTPTransportReporter(c, nil)}
+	_, err := cli.Get(srv.URL)
+	require.Error(t, err)
+
+	call := <-c.q
+	assert.Equal(t, CallBad, call.Success)
+}
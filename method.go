@@ -48,3 +48,19 @@ func (m Method) Merge(def Method) Method {
 	}
 	return m
 }
+
+// inboundMethod describes a call from source which was received by the local service,
+// the caller's region and type are left empty when they aren't known
+func inboundMethod(local Method, source, sourceRegion string, t api.Transport) Method {
+	if source == "" {
+		source = "unknown"
+	}
+	return Method{
+		Source:       source,
+		SourceRegion: sourceRegion,
+		Target:       local.Source,
+		TargetRegion: local.SourceRegion,
+		TargetType:   local.SourceType,
+		Transport:    t,
+	}
+}
@@ -2,78 +2,129 @@ package db
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
 )
 
-const (
-	BucketDuration = time.Minute
-	DefaultNodeTTL = time.Hour
-)
+const DefaultBucketDuration = time.Minute
 
 // Bucket is stored as a Unix timestamp key with a redis set of values
 // These values are serialised TrafficKey keys
+// In LayoutHash it's stored as a single hash instead, see Keyspace.hashKey
 type Bucket struct {
 	time.Time
+	Duration time.Duration
 }
 
 func (b Bucket) Previous() Bucket {
-	return Bucket{b.Add(-BucketDuration)}
+	return Bucket{b.Add(-b.Duration), b.Duration}
 }
 
 func (b Bucket) Next() Bucket {
-	return Bucket{b.Add(BucketDuration)}
+	return Bucket{b.Add(b.Duration), b.Duration}
+}
+
+func (b Bucket) End() time.Time {
+	return b.Add(b.Duration)
+}
+
+// Split returns the buckets of duration d which make up b
+func (b Bucket) Split(d time.Duration) []Bucket {
+	var ret []Bucket
+	for s := BucketFromTime(b.Time, d); s.Before(b.End()); s = s.Next() {
+		ret = append(ret, s)
+	}
+	return ret
 }
 
-func BucketFromTime(t time.Time) Bucket {
-	return Bucket{t.Truncate(BucketDuration)}
+func BucketFromTime(t time.Time, d time.Duration) Bucket {
+	return Bucket{t.Truncate(d), d}
 }
 
-func GetBucketsBetween(from, to time.Time) []Bucket {
+// GetBucketsBetween returns the buckets of duration d from the one containing from,
+// up to and including the one containing to
+func GetBucketsBetween(from, to time.Time, d time.Duration) []Bucket {
 	var ret []Bucket
-	for b := BucketFromTime(from); !b.After(to); b = b.Next() {
+	for b := BucketFromTime(from, d); !b.After(to); b = b.Next() {
 		ret = append(ret, b)
 	}
 	return ret
 }
 
-func StoreBucket(ctx context.Context, conn redis.Conn,
-	bucket Bucket, keys []TrafficKey, ttl time.Duration,
-) error {
-	args := make([]interface{}, 0, len(keys)+1)
-	args = append(args, bucket.Unix())
-	for _, k := range keys {
-		args = append(args, trafficKeyToRedis(k))
+// bucketToRedis formats the bucket's part of a key, buckets with the
+// default duration keep the plain timestamp format they have always had
+func bucketToRedis(b Bucket) string {
+	ts := strconv.FormatInt(b.Unix(), 10)
+	if b.Duration == DefaultBucketDuration {
+		return ts
 	}
-	_, err := redis.DoContext(conn, ctx,
-		"SADD", args...,
-	)
+	return ts + "_" + strconv.FormatInt(int64(b.Duration/time.Second), 10)
+}
+
+func (ks Keyspace) bucketKey(b Bucket) string {
+	return ks.Prefix + bucketToRedis(b)
+}
+
+func bucketFromRedis(s string) (Bucket, error) {
+	ts, dur, found := strings.Cut(s, "_")
+	unix, err := strconv.ParseInt(ts, 10, 64)
 	if err != nil {
-		return errors.Wrap(err, "")
+		return Bucket{}, errors.Wrap(err, "invalid timestamp", j.KV("value", s))
+	}
+	d := DefaultBucketDuration
+	if found {
+		secs, err := strconv.ParseInt(dur, 10, 64)
+		if err != nil || secs <= 0 {
+			return Bucket{}, errors.New("invalid bucket duration", j.KV("value", s))
+		}
+		d = time.Duration(secs) * time.Second
 	}
-	expire := bucket.Add(ttl)
-	_, err = redis.DoContext(conn, ctx,
-		"EXPIREAT", bucket.Unix(), expire.Unix(),
-	)
-	return errors.Wrap(err, "")
+	return Bucket{time.Unix(unix, 0), d}, nil
 }
 
-func GetBucket(ctx context.Context, conn redis.Conn, bucket Bucket) ([]TrafficKey, error) {
-	keys, err := redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", bucket.Unix()))
+// GetBucket returns the traffic stored in the bucket in either layout,
+// both are read in one round trip and another is needed for LayoutKeys' values
+func GetBucket(ctx context.Context, conn redis.Conn, ks Keyspace, bucket Bucket) ([]TrafficStat, error) {
+	if err := conn.Send("SMEMBERS", ks.bucketKey(bucket)); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if err := conn.Send("HGETALL", ks.hashKey(bucket)); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	members, err := redis.Strings(redis.ReceiveContext(conn, ctx))
 	if err != nil {
 		return nil, errors.Wrap(err, "")
 	}
-	ret := make([]TrafficKey, 0, len(keys))
-	for _, k := range keys {
-		tk, err := trafficKeyFromRedis(k)
+	fields, err := redis.Int64Map(redis.ReceiveContext(conn, ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	ret := statsFromHash(ctx, bucket, fields)
+	keys := make([]TrafficKey, 0, len(members))
+	for _, k := range members {
+		tk, err := trafficKeyFromRedis(strings.TrimPrefix(k, ks.Prefix))
 		if err != nil {
 			log.Error(ctx, err)
 			continue
 		}
-		ret = append(ret, tk)
+		keys = append(keys, tk)
+	}
+	if len(keys) == 0 {
+		return ret, nil
+	}
+	stats, err := getTraffic(ctx, conn, ks, keys)
+	if err != nil {
+		return nil, err
 	}
-	return ret, nil
+	return append(ret, stats...), nil
 }
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+const clusterSlots = 16384
+
+var ErrNoSlotOwner = errors.New("no redis cluster node serves the slot", j.C("ERR_b54dc040ba084724"))
+
+// KeySlot is the Redis Cluster slot which key is stored in
+func KeySlot(key string) int {
+	return int(crc16([]byte(hashTag(key))) % clusterSlots)
+}
+
+// hashTag is the part of key which Redis Cluster hashes to find its slot,
+// which is what's in the first {...} if it isn't empty, or else the whole key
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// crc16 is CRC-16/XMODEM, as used by Redis Cluster
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// SlotOwner asks a cluster node for the address of the primary node which serves slot,
+// the host is empty when it's the node which was asked
+func SlotOwner(ctx context.Context, conn redis.Conn, slot int) (string, error) {
+	ranges, err := redis.Values(redis.DoContext(conn, ctx, "CLUSTER", "SLOTS"))
+	if err != nil {
+		return "", errors.Wrap(err, "")
+	}
+	for _, r := range ranges {
+		// Each range is its first slot, last slot, then its primary and replicas as [host, port, ...]
+		v, err := redis.Values(r, nil)
+		if err != nil || len(v) < 3 {
+			return "", errors.New("invalid cluster slots reply")
+		}
+		first, err := redis.Int(v[0], nil)
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+		last, err := redis.Int(v[1], nil)
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+		if slot < first || slot > last {
+			continue
+		}
+		node, err := redis.Values(v[2], nil)
+		if err != nil || len(node) < 2 {
+			return "", errors.New("invalid cluster slots reply")
+		}
+		host, err := redis.String(node[0], nil)
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+		port, err := redis.Int(node[1], nil)
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+	return "", errors.Wrap(ErrNoSlotOwner, "", j.KV("slot", slot))
+}
+
+// clusterConn is a connection to the node serving a slot, it breaks once the node
+// redirects a command with MOVED or ASK, so that the pool discards it and dials
+// whichever node serves the slot now
+type clusterConn struct {
+	redis.Conn
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewClusterConn wraps a connection to a cluster node so that Err
+// returns an error once a command has been redirected to another node
+func NewClusterConn(conn redis.Conn) redis.Conn {
+	return &clusterConn{Conn: conn}
+}
+
+func (c *clusterConn) Err() error {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.Conn.Err()
+}
+
+func (c *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.check(c.Conn.Do(cmd, args...))
+}
+
+func (c *clusterConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return c.check(redis.DoContext(c.Conn, ctx, cmd, args...))
+}
+
+func (c *clusterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return c.check(redis.DoWithTimeout(c.Conn, timeout, cmd, args...))
+}
+
+func (c *clusterConn) Receive() (interface{}, error) {
+	return c.check(c.Conn.Receive())
+}
+
+func (c *clusterConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return c.check(redis.ReceiveContext(c.Conn, ctx))
+}
+
+func (c *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.check(redis.ReceiveWithTimeout(c.Conn, timeout))
+}
+
+func (c *clusterConn) check(reply interface{}, err error) (interface{}, error) {
+	if rerr := redirection(reply, err); rerr != nil {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = errors.Wrap(rerr, "slot has moved")
+		}
+		c.mu.Unlock()
+	}
+	return reply, err
+}
+
+// redirection finds a MOVED or ASK error in a reply, including in the replies from EXEC
+func redirection(reply interface{}, err error) error {
+	if isRedirection(err) {
+		return err
+	}
+	vals, ok := reply.([]interface{})
+	if !ok {
+		return nil
+	}
+	for _, v := range vals {
+		if err, ok := v.(redis.Error); ok && isRedirection(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func isRedirection(err error) bool {
+	var rerr redis.Error
+	if !errors.As(err, &rerr) {
+		return false
+	}
+	s := string(rerr)
+	return strings.HasPrefix(s, "MOVED ") || strings.HasPrefix(s, "ASK ")
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySlot(t *testing.T) {
+	testCases := []struct {
+		key string
+		exp int
+	}{
+		{key: "123456789", exp: 0x31c3},
+		{key: "foo", exp: 12182},
+		{key: "bar", exp: 5061},
+		{key: "{foo}.bar", exp: 12182},
+		{key: "{foo}.baz", exp: 12182},
+		{key: "baz.{foo}", exp: 12182},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			assert.Equal(t, tc.exp, KeySlot(tc.key))
+		})
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	testCases := []struct {
+		key string
+		exp string
+	}{
+		{key: "gridlock", exp: "gridlock"},
+		{key: "{gridlock}.", exp: "gridlock"},
+		{key: "a{gridlock}b{c}", exp: "gridlock"},
+		{key: "{}gridlock", exp: "{}gridlock"},
+		{key: "gridlock{", exp: "gridlock{"},
+		{key: "gridlock}{", exp: "gridlock}{"},
+		{key: "{{gridlock}}", exp: "{gridlock"},
+		{key: "a{}{b}", exp: "a{}{b}"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			assert.Equal(t, tc.exp, hashTag(tc.key))
+		})
+	}
+}
+
+func TestRedirection(t *testing.T) {
+	testCases := []struct {
+		name  string
+		reply interface{}
+		err   error
+		exp   bool
+	}{
+		{name: "ok", reply: "OK"},
+		{name: "error", err: redis.Error("ERR wrong number of arguments")},
+		{name: "moved", err: redis.Error("MOVED 3999 127.0.0.1:6381"), exp: true},
+		{name: "ask", err: redis.Error("ASK 3999 127.0.0.1:6381"), exp: true},
+		{name: "wrapped", err: errors.Wrap(redis.Error("MOVED 3999 127.0.0.1:6381"), ""), exp: true},
+		{
+			name:  "exec",
+			reply: []interface{}{int64(1), redis.Error("MOVED 3999 127.0.0.1:6381")},
+			exp:   true,
+		},
+		{name: "exec error", reply: []interface{}{int64(1), redis.Error("WRONGTYPE")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, redirection(tc.reply, tc.err) != nil)
+		})
+	}
+}
+
+func TestClusterConnBreaksWhenRedirected(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeRedis()
+	conn := NewClusterConn(f)
+
+	_, err := redis.DoContext(conn, ctx, "UNKNOWN")
+	require.Error(t, err)
+	jtest.RequireNil(t, conn.Err())
+
+	_, err = redis.DoContext(conn, ctx, "SET", "key", "value")
+	jtest.RequireNil(t, err)
+
+	f.err = redis.Error("MOVED 3999 127.0.0.1:6381")
+	_, err = redis.DoContext(conn, ctx, "GET", "key")
+	require.Error(t, err)
+	require.Error(t, conn.Err())
+
+	// Stays broken so the pool discards it
+	f.err = nil
+	_, err = redis.DoContext(conn, ctx, "GET", "key")
+	jtest.RequireNil(t, err)
+	require.Error(t, conn.Err())
+}
@@ -4,32 +4,61 @@ import (
 	"context"
 	"crypto/sha1"
 	"fmt"
+	"strings"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/luno/gridlock/api"
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 )
 
-const (
-	trafficDatabase = 0
-	nodeDatabase    = 1
-)
+// Keyspace is where gridlock keeps its keys, so that it can share a redis server
+type Keyspace struct {
+	// Prefix is prepended to every key and pub/sub channel
+	Prefix string
+	// TrafficDB and NodeDB are the databases traffic and nodes are kept in, they can be the same
+	TrafficDB int
+	NodeDB    int
+	// Cluster is set for Redis Cluster, which only has database 0.
+	// The prefix must have a hash tag so that every key is in the same slot,
+	// transactions and MGET don't work across slots.
+	Cluster bool
+}
+
+var DefaultKeyspace = Keyspace{TrafficDB: 0, NodeDB: 1}
+
+var ErrNoHashTag = errors.New("redis cluster needs a hash tag in the key prefix", j.C("ERR_14011fcc7fc77933"))
+
+func (ks Keyspace) Validate() error {
+	if ks.Cluster && hashTag(ks.Prefix) == ks.Prefix {
+		return errors.Wrap(ErrNoHashTag, "", j.KV("prefix", ks.Prefix))
+	}
+	return nil
+}
 
-func SelectTrafficDatabase(r redis.Conn) error {
-	return selectDB(r, trafficDatabase)
+// ChangesChannel is the channel traffic changes are published to, see DecodeChanges
+func (ks Keyspace) ChangesChannel() string {
+	return ks.Prefix + changesChannel
 }
 
-func SelectNodeDatabase(r redis.Conn) error {
-	return selectDB(r, nodeDatabase)
+func SelectTrafficDatabase(r redis.Conn, ks Keyspace) error {
+	return selectDB(r, ks, ks.TrafficDB)
 }
 
-func selectDB(r redis.Conn, db int) error {
+func SelectNodeDatabase(r redis.Conn, ks Keyspace) error {
+	return selectDB(r, ks, ks.NodeDB)
+}
+
+func selectDB(r redis.Conn, ks Keyspace, db int) error {
+	if ks.Cluster {
+		return nil
+	}
 	_, err := r.Do("SELECT", db)
 	return err
 }
 
-func scanSomeKeys(ctx context.Context, conn redis.Conn, cursor int64) ([]string, int64, error) {
-	resp, err := redis.Values(redis.DoContext(conn, ctx, "SCAN", cursor))
+func scanSomeKeys(ctx context.Context, conn redis.Conn, cursor int64, match string) ([]string, int64, error) {
+	resp, err := redis.Values(redis.DoContext(conn, ctx, "SCAN", cursor, "MATCH", match))
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "")
 	}
@@ -41,6 +70,19 @@ func scanSomeKeys(ctx context.Context, conn redis.Conn, cursor int64) ([]string,
 	return keys, next, errors.Wrap(err, "")
 }
 
+// escapeMatch escapes the characters in s which are special in SCAN's MATCH patterns
+func escapeMatch(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 type NodeKey struct {
 	Region string
 	Name   string
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyspaceValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		ks     Keyspace
+		expErr error
+	}{
+		{name: "default", ks: DefaultKeyspace},
+		{name: "prefix", ks: Keyspace{Prefix: "gridlock."}},
+		{name: "cluster", ks: Keyspace{Prefix: "{gridlock}.", Cluster: true}},
+		{name: "cluster without prefix", ks: Keyspace{Cluster: true}, expErr: ErrNoHashTag},
+		{name: "cluster without hash tag", ks: Keyspace{Prefix: "gridlock.", Cluster: true}, expErr: ErrNoHashTag},
+		{name: "cluster with empty hash tag", ks: Keyspace{Prefix: "{}gridlock.", Cluster: true}, expErr: ErrNoHashTag},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jtest.Assert(t, tc.expErr, tc.ks.Validate())
+		})
+	}
+}
+
+func TestEscapeMatch(t *testing.T) {
+	testCases := []struct {
+		s   string
+		exp string
+	}{
+		{s: "", exp: ""},
+		{s: "gridlock.", exp: "gridlock."},
+		{s: "{gridlock}.", exp: "{gridlock}."},
+		{s: "a*b?c", exp: `a\*b\?c`},
+		{s: "[ab]", exp: `\[ab\]`},
+		{s: `a\b`, exp: `a\\b`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.s, func(t *testing.T) {
+			assert.Equal(t, tc.exp, escapeMatch(tc.s))
+		})
+	}
+}
+
+func TestKeyspacePrefix(t *testing.T) {
+	ks := Keyspace{Prefix: "{gl}."}
+	b := Bucket{time.Unix(1700000040, 0), DefaultBucketDuration}
+	k := TrafficKey{FromID: "a", ToID: "b", Transport: "http", Bucket: b, Level: Good}
+
+	assert.Equal(t, "{gl}.a.b.http.1700000040.good", ks.trafficKey(k))
+	assert.Equal(t, "{gl}.1700000040", ks.bucketKey(b))
+	assert.Equal(t, "{gl}.traffic.1700000040", ks.hashKey(b))
+	assert.Equal(t, "{gl}.abc", ks.nodeKey("abc"))
+	assert.Equal(t, "{gl}.gridlock.changes", ks.ChangesChannel())
+
+	var none Keyspace
+	assert.Equal(t, "a.b.http.1700000040.good", none.trafficKey(k))
+	assert.Equal(t, "1700000040", none.bucketKey(b))
+	assert.Equal(t, "gridlock.changes", none.ChangesChannel())
+}
+
+func TestPrefixedNodes(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	ks := Keyspace{Prefix: "[gl]*."}
+	other := Keyspace{Prefix: "other."}
+
+	id := Key(api.NodeInfo{Name: "a"}).ID()
+	jtest.RequireNil(t, StoreNode(ctx, conn, ks, id, api.NodeInfo{Name: "a"}, time.Hour))
+	jtest.RequireNil(t, StoreNode(ctx, conn, other, Key(api.NodeInfo{Name: "b"}).ID(), api.NodeInfo{Name: "b"}, time.Hour))
+	jtest.RequireNil(t, conn.Send("SET", "[gl]*.not-a-node", "x"))
+
+	ids, next, err := GetSomeNodeIDs(ctx, conn, ks, 0)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, []string{id}, ids)
+	assert.Equal(t, int64(0), next)
+
+	ni, err := GetNode(ctx, conn, ks, id, time.Hour)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "a", ni.Name)
+
+	_, err = GetNode(ctx, conn, other, id, time.Hour)
+	jtest.Assert(t, ErrNodeNotFound, err)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// Layout is how traffic is arranged in redis
+type Layout int
+
+const (
+	// LayoutKeys stores each level of an edge's traffic in a bucket in its own key,
+	// with a set per bucket listing its keys
+	LayoutKeys Layout = 1
+	// LayoutHash stores each bucket in a single hash, with a field for each level of
+	// each edge and a field for each histogram bucket of its latency
+	LayoutHash Layout = 2
+)
+
+func (ks Keyspace) hashKey(b Bucket) string {
+	return ks.Prefix + "traffic." + bucketToRedis(b)
+}
+
+// trafficField is the field of a count in its bucket's hash
+func trafficField(k TrafficKey) string {
+	return strings.Join([]string{k.FromID, k.ToID, k.Transport, string(k.Level)}, ".")
+}
+
+// latencyField is the field of one histogram bucket of a latency in its bucket's hash
+func latencyField(k TrafficKey, i int) string {
+	return trafficField(k) + "." + strconv.Itoa(i)
+}
+
+func sendHashStat(conn redis.Conn, ks Keyspace, s TrafficStat, replace bool) error {
+	key := ks.hashKey(s.Key.Bucket)
+	cmd := "HINCRBY"
+	if replace {
+		cmd = "HSET"
+	}
+	if s.Key.Level != Latency {
+		return errors.Wrap(conn.Send(cmd, key, trafficField(s.Key), s.Count), "")
+	}
+	if replace {
+		if err := sendDelField(conn, ks, s.Key); err != nil {
+			return err
+		}
+	}
+	for i, n := range s.Latency {
+		if n == 0 {
+			continue
+		}
+		if err := conn.Send(cmd, key, latencyField(s.Key, i), n); err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	return nil
+}
+
+// sendDelField removes a stat stored in LayoutHash
+func sendDelField(conn redis.Conn, ks Keyspace, k TrafficKey) error {
+	args := []interface{}{ks.hashKey(k.Bucket)}
+	if k.Level == Latency {
+		for i := 0; i < api.HistogramBuckets; i++ {
+			args = append(args, latencyField(k, i))
+		}
+	} else {
+		args = append(args, trafficField(k))
+	}
+	return errors.Wrap(conn.Send("HDEL", args...), "")
+}
+
+// sendDelKey removes a stat stored in LayoutKeys
+func sendDelKey(conn redis.Conn, ks Keyspace, k TrafficKey) error {
+	key := ks.trafficKey(k)
+	if err := conn.Send("DEL", key); err != nil {
+		return errors.Wrap(err, "")
+	}
+	return errors.Wrap(conn.Send("SREM", ks.bucketKey(k.Bucket), key), "")
+}
+
+// statsFromHash parses the fields of a bucket's hash, invalid fields are skipped
+func statsFromHash(ctx context.Context, b Bucket, fields map[string]int64) []TrafficStat {
+	var ret []TrafficStat
+	latencies := make(map[TrafficKey]map[string]int64)
+	for f, n := range fields {
+		p := strings.Split(f, ".")
+		if len(p) < 4 {
+			log.Error(ctx, errors.New("invalid field", j.KV("field", f)))
+			continue
+		}
+		k := TrafficKey{FromID: p[0], ToID: p[1], Transport: p[2], Bucket: b, Level: Level(p[3])}
+		switch {
+		case len(p) == 4 && (k.Level == Good || k.Level == Warning || k.Level == Bad):
+			ret = append(ret, TrafficStat{Key: k, Count: n})
+		case len(p) == 5 && k.Level == Latency:
+			if latencies[k] == nil {
+				latencies[k] = make(map[string]int64)
+			}
+			latencies[k][p[4]] = n
+		default:
+			log.Error(ctx, errors.New("invalid field", j.KV("field", f)))
+		}
+	}
+	for k, m := range latencies {
+		h, err := histogramFromRedis(m)
+		if err != nil {
+			log.Error(ctx, err)
+			continue
+		}
+		ret = append(ret, TrafficStat{Key: k, Latency: h})
+	}
+	return ret
+}
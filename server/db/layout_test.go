@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsFromHash(t *testing.T) {
+	testCases := []struct {
+		name   string
+		fields map[string]int64
+		exp    []TrafficStat
+	}{
+		{name: "empty"},
+		{
+			name:   "counts",
+			fields: map[string]int64{"a.b.http.good": 10, "a.b.http.warning": 2, "a.c.grpc.bad": 1},
+			exp: []TrafficStat{
+				{Key: testKey("a", Good), Count: 10},
+				{Key: testKey("a", Warning), Count: 2},
+				{Key: TrafficKey{FromID: "a", ToID: "c", Transport: "grpc", Bucket: testBucket, Level: Bad}, Count: 1},
+			},
+		},
+		{
+			name:   "latency",
+			fields: map[string]int64{"a.b.http.latency.0": 1, "a.b.http.latency.3": 4},
+			exp:    []TrafficStat{{Key: testKey("a", Latency), Latency: api.Histogram{1, 0, 0, 4}}},
+		},
+		{
+			name: "invalid fields are skipped",
+			fields: map[string]int64{
+				"a.b.http.good":       1,
+				"a.b.http":            1,
+				"a.b.http.great":      1,
+				"a.b.http.good.1":     1,
+				"a.b.http.latency":    1,
+				"c.b.http.latency.x":  1,
+				"d.b.http.latency.99": 1,
+			},
+			exp: []TrafficStat{{Key: testKey("a", Good), Count: 1}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tc.exp, statsFromHash(context.Background(), testBucket, tc.fields))
+		})
+	}
+}
+
+func TestSendHashStat(t *testing.T) {
+	existing := map[string]int64{
+		"a.b.http.good":      10,
+		"a.b.http.latency.0": 1,
+		"a.b.http.latency.5": 2,
+	}
+	testCases := []struct {
+		name    string
+		stat    TrafficStat
+		replace bool
+		exp     map[string]int64
+	}{
+		{
+			name: "add count",
+			stat: TrafficStat{Key: testKey("a", Good), Count: 5},
+			exp:  map[string]int64{"a.b.http.good": 15, "a.b.http.latency.0": 1, "a.b.http.latency.5": 2},
+		},
+		{
+			name:    "replace count",
+			stat:    TrafficStat{Key: testKey("a", Good), Count: 5},
+			replace: true,
+			exp:     map[string]int64{"a.b.http.good": 5, "a.b.http.latency.0": 1, "a.b.http.latency.5": 2},
+		},
+		{
+			name: "add new count",
+			stat: TrafficStat{Key: testKey("a", Bad), Count: 1},
+			exp:  map[string]int64{"a.b.http.good": 10, "a.b.http.bad": 1, "a.b.http.latency.0": 1, "a.b.http.latency.5": 2},
+		},
+		{
+			name: "add latency",
+			stat: TrafficStat{Key: testKey("a", Latency), Latency: api.Histogram{3, 0, 1}},
+			exp:  map[string]int64{"a.b.http.good": 10, "a.b.http.latency.0": 4, "a.b.http.latency.2": 1, "a.b.http.latency.5": 2},
+		},
+		{
+			name:    "replace latency",
+			stat:    TrafficStat{Key: testKey("a", Latency), Latency: api.Histogram{3, 0, 1}},
+			replace: true,
+			exp:     map[string]int64{"a.b.http.good": 10, "a.b.http.latency.0": 3, "a.b.http.latency.2": 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newFakeRedis()
+			var ks Keyspace
+			for f, n := range existing {
+				jtest.RequireNil(t, conn.Send("HSET", ks.hashKey(testBucket), f, n))
+			}
+			jtest.RequireNil(t, sendHashStat(conn, ks, tc.stat, tc.replace))
+			assert.Equal(t, tc.exp, conn.hashes[ks.hashKey(testBucket)])
+		})
+	}
+}
+
+func TestSendDelField(t *testing.T) {
+	testCases := []struct {
+		name string
+		key  TrafficKey
+		exp  map[string]int64
+	}{
+		{
+			name: "count",
+			key:  testKey("a", Good),
+			exp:  map[string]int64{"a.b.http.bad": 1, "a.b.http.latency.0": 1, "a.b.http.latency.47": 1, "c.b.http.good": 1},
+		},
+		{
+			name: "latency",
+			key:  testKey("a", Latency),
+			exp:  map[string]int64{"a.b.http.good": 1, "a.b.http.bad": 1, "c.b.http.good": 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newFakeRedis()
+			var ks Keyspace
+			for _, f := range []string{"a.b.http.good", "a.b.http.bad", "a.b.http.latency.0", "a.b.http.latency.47", "c.b.http.good"} {
+				jtest.RequireNil(t, conn.Send("HSET", ks.hashKey(testBucket), f, 1))
+			}
+			jtest.RequireNil(t, sendDelField(conn, ks, tc.key))
+			assert.Equal(t, tc.exp, conn.hashes[ks.hashKey(testBucket)])
+		})
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	ctx := context.Background()
+	stats := []TrafficStat{
+		{Key: testKey("a", Good), Count: 10},
+		{Key: testKey("a", Warning), Count: 2},
+		{Key: testKey("a", Latency), Latency: api.Histogram{0, 2, 3}},
+		{Key: testKey("c", Bad), Count: 5},
+	}
+	rollup := []TrafficStat{
+		{Key: testKey("a", Good), Count: 7},
+		{Key: testKey("a", Latency), Latency: api.Histogram{1}},
+	}
+	testCases := []struct {
+		name  string
+		first Layout
+		then  Layout
+	}{
+		{name: "keys", first: LayoutKeys, then: LayoutKeys},
+		{name: "hash", first: LayoutHash, then: LayoutHash},
+		{name: "keys then hash", first: LayoutKeys, then: LayoutHash},
+		{name: "hash then keys", first: LayoutHash, then: LayoutKeys},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newFakeRedis()
+			ks := Keyspace{Prefix: "gl."}
+
+			// A bucket written in the old layout is read along with what's written in the new one
+			jtest.RequireNil(t, StoreTraffic(ctx, conn, ks, tc.first, stats[:2], testTTL))
+			jtest.RequireNil(t, StoreTraffic(ctx, conn, ks, tc.then, stats[2:], testTTL))
+			got, err := GetBucket(ctx, conn, ks, testBucket)
+			jtest.RequireNil(t, err)
+			assert.ElementsMatch(t, stats, got)
+
+			// Replacing a stat removes it from the other layout
+			jtest.RequireNil(t, SetTraffic(ctx, conn, ks, tc.then, rollup, testTTL))
+			got, err = GetBucket(ctx, conn, ks, testBucket)
+			jtest.RequireNil(t, err)
+			assert.ElementsMatch(t, append([]TrafficStat{stats[1], stats[3]}, rollup...), got)
+		})
+	}
+}
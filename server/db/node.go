@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -11,28 +13,81 @@ import (
 	"github.com/luno/jettison/j"
 )
 
-const nodeTTL = time.Hour
-
 var ErrNodeNotFound = errors.New("node not found", j.C("ERR_b747d53800a4219d"))
 
-func StoreNode(ctx context.Context, conn redis.Conn, key string, info api.NodeInfo) error {
+// nodeIDPattern matches node IDs, which are hex sha1 hashes, so that
+// nodes can be scanned for when they share a database with traffic
+var nodeIDPattern = strings.Repeat("[0-9a-f]", 40)
+
+func (ks Keyspace) nodeKey(id string) string {
+	return ks.Prefix + id
+}
+
+// StoreNode saves a node for ttl, which is extended every time it's read
+func StoreNode(ctx context.Context, conn redis.Conn, ks Keyspace, id string, info api.NodeInfo, ttl time.Duration) error {
 	b, err := json.Marshal(info)
 	if err != nil {
 		return err
 	}
 	_, err = redis.DoContext(conn, ctx,
-		"SET", key, b, "EX", int(nodeTTL.Seconds()),
+		"SET", ks.nodeKey(id), b, "EX", int(ttl.Seconds()),
 	)
 	return errors.Wrap(err, "store node")
 }
 
-func GetSomeNodeKeys(ctx context.Context, conn redis.Conn, cursor int64) ([]string, int64, error) {
-	return scanSomeKeys(ctx, conn, cursor)
+// StoreNodes saves the nodes which aren't already stored and extends the ttl of every one,
+// they're pipelined so it costs one round trip however many there are
+func StoreNodes(ctx context.Context, conn redis.Conn, ks Keyspace, nodes map[string]api.NodeInfo, ttl time.Duration) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		b, err := json.Marshal(nodes[id])
+		if err != nil {
+			return err
+		}
+		key := ks.nodeKey(id)
+		if err := conn.Send("SET", key, b, "EX", int(ttl.Seconds()), "NX"); err != nil {
+			return errors.Wrap(err, "")
+		}
+		if err := conn.Send("EXPIRE", key, int(ttl.Seconds())); err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	// Do with no command receives every pending reply
+	res, err := redis.Values(redis.DoContext(conn, ctx, ""))
+	if err != nil {
+		return errors.Wrap(err, "store nodes")
+	}
+	for _, r := range res {
+		if err, ok := r.(redis.Error); ok {
+			return errors.Wrap(err, "store nodes")
+		}
+	}
+	return nil
+}
+
+// GetSomeNodeIDs scans for nodes from cursor, it returns the cursor to continue from or zero when it's done
+func GetSomeNodeIDs(ctx context.Context, conn redis.Conn, ks Keyspace, cursor int64) ([]string, int64, error) {
+	keys, next, err := scanSomeKeys(ctx, conn, cursor, escapeMatch(ks.Prefix)+nodeIDPattern)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ids = append(ids, strings.TrimPrefix(k, ks.Prefix))
+	}
+	return ids, next, nil
 }
 
-func GetNode(ctx context.Context, conn redis.Conn, key string) (api.NodeInfo, error) {
+func GetNode(ctx context.Context, conn redis.Conn, ks Keyspace, id string, ttl time.Duration) (api.NodeInfo, error) {
 	v, err := redis.Bytes(redis.DoContext(conn, ctx,
-		"GETEX", key, "EX", int(nodeTTL.Seconds()),
+		"GETEX", ks.nodeKey(id), "EX", int(ttl.Seconds()),
 	))
 	if errors.Is(err, redis.ErrNil) {
 		return api.NodeInfo{}, errors.Wrap(ErrNodeNotFound, "")
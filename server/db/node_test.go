@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreNodes(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	ks := Keyspace{Prefix: "gl."}
+
+	a := api.NodeInfo{Region: "region-a", Name: "a", DisplayName: "A", Type: api.NodeService}
+	b := api.NodeInfo{Region: "region-a", Name: "b", Type: api.NodeDatabase}
+	idA, idB := Key(a).ID(), Key(b).ID()
+	jtest.RequireNil(t, StoreNode(ctx, conn, ks, idA, a, time.Minute))
+
+	conn.roundTrips = 0
+	renamed := a
+	renamed.DisplayName = "Renamed"
+	jtest.RequireNil(t, StoreNodes(ctx, conn, ks, map[string]api.NodeInfo{idA: renamed, idB: b}, time.Hour))
+	assert.Equal(t, 1, conn.roundTrips)
+
+	// Nodes which were already stored are kept, but for longer
+	ni, err := GetNode(ctx, conn, ks, idA, time.Hour)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, a, ni)
+	ni, err = GetNode(ctx, conn, ks, idB, time.Hour)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, b, ni)
+	assert.Equal(t, int64(3600), conn.expires["gl."+idA])
+	assert.Equal(t, int64(3600), conn.expires["gl."+idB])
+
+	conn.roundTrips = 0
+	jtest.RequireNil(t, StoreNodes(ctx, conn, ks, nil, time.Hour))
+	assert.Equal(t, 0, conn.roundTrips)
+}
+
+func TestStoreNodesError(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	conn.err = errors.New("READONLY You can't write against a read only replica.")
+
+	err := StoreNodes(ctx, conn, Keyspace{}, map[string]api.NodeInfo{"a": {Name: "a"}}, time.Hour)
+	require.Error(t, err)
+}
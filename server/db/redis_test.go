@@ -0,0 +1,277 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// fakeRedis is an in-memory redis.Conn which implements the commands gridlock uses
+type fakeRedis struct {
+	strings map[string][]byte
+	sets    map[string]map[string]bool
+	hashes  map[string]map[string]int64
+	// expires is the unix time keys expire at, or their ttl in seconds when it was set relatively
+	expires map[string]int64
+	// published messages by channel
+	published map[string][][]byte
+
+	// err is returned by every command when set, like a MOVED redirection
+	err error
+	// roundTrips counts the times commands are sent to the server
+	roundTrips int
+
+	pending []interface{}
+	multi   [][]interface{}
+	inMulti bool
+	closed  bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		strings:   make(map[string][]byte),
+		sets:      make(map[string]map[string]bool),
+		hashes:    make(map[string]map[string]int64),
+		expires:   make(map[string]int64),
+		published: make(map[string][][]byte),
+	}
+}
+
+func (f *fakeRedis) Close() error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeRedis) Err() error {
+	if f.closed {
+		return fmt.Errorf("closed")
+	}
+	return nil
+}
+
+func (f *fakeRedis) Send(cmd string, args ...interface{}) error {
+	f.pending = append(f.pending, f.exec(cmd, args))
+	return nil
+}
+
+func (f *fakeRedis) Flush() error {
+	f.roundTrips++
+	return nil
+}
+
+func (f *fakeRedis) Receive() (interface{}, error) {
+	if len(f.pending) == 0 {
+		return nil, fmt.Errorf("no pending replies")
+	}
+	r := f.pending[0]
+	f.pending = f.pending[1:]
+	if err, ok := r.(redis.Error); ok {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (f *fakeRedis) ReceiveContext(context.Context) (interface{}, error) {
+	return f.Receive()
+}
+
+func (f *fakeRedis) ReceiveWithTimeout(time.Duration) (interface{}, error) {
+	return f.Receive()
+}
+
+// Do receives every pending reply like redigo, returning the last with the first error,
+// or all of them when there's no command
+func (f *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" && len(f.pending) == 0 {
+		return nil, nil
+	}
+	if cmd != "" {
+		_ = f.Send(cmd, args...)
+	}
+	f.roundTrips++
+	replies := f.pending
+	f.pending = nil
+	if cmd == "" {
+		return replies, nil
+	}
+	var err error
+	for _, r := range replies {
+		if e, ok := r.(redis.Error); ok && err == nil {
+			err = e
+		}
+	}
+	return replies[len(replies)-1], err
+}
+
+func (f *fakeRedis) DoContext(_ context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	return f.Do(cmd, args...)
+}
+
+func (f *fakeRedis) DoWithTimeout(_ time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return f.Do(cmd, args...)
+}
+
+func (f *fakeRedis) exec(cmd string, args []interface{}) interface{} {
+	if f.err != nil {
+		return redis.Error(f.err.Error())
+	}
+	cmd = strings.ToUpper(cmd)
+	switch {
+	case cmd == "MULTI":
+		f.inMulti = true
+		return "OK"
+	case cmd == "EXEC":
+		f.inMulti = false
+		var ret []interface{}
+		for _, c := range f.multi {
+			ret = append(ret, f.run(c[0].(string), c[1:]))
+		}
+		f.multi = nil
+		return ret
+	case f.inMulti:
+		f.multi = append(f.multi, append([]interface{}{cmd}, args...))
+		return "QUEUED"
+	}
+	return f.run(cmd, args)
+}
+
+func (f *fakeRedis) run(cmd string, args []interface{}) interface{} {
+	s := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case []byte:
+			s[i] = string(v)
+		default:
+			s[i] = fmt.Sprint(v)
+		}
+	}
+	switch cmd {
+	case "PING":
+		return "PONG"
+	case "SELECT":
+		return "OK"
+	case "GET", "GETEX":
+		v, ok := f.strings[s[0]]
+		if !ok {
+			return nil
+		}
+		return v
+	case "MGET":
+		ret := make([]interface{}, len(s))
+		for i, k := range s {
+			if v, ok := f.strings[k]; ok {
+				ret[i] = v
+			}
+		}
+		return ret
+	case "SET":
+		var nx bool
+		var expire int64
+		for i := 2; i < len(s); i++ {
+			switch strings.ToUpper(s[i]) {
+			case "NX":
+				nx = true
+			case "EX", "EXAT":
+				i++
+				expire, _ = strconv.ParseInt(s[i], 10, 64)
+			}
+		}
+		if _, ok := f.strings[s[0]]; ok && nx {
+			return nil
+		}
+		f.strings[s[0]] = []byte(s[1])
+		if expire != 0 {
+			f.expires[s[0]] = expire
+		}
+		return "OK"
+	case "INCRBY":
+		n, _ := strconv.ParseInt(string(f.strings[s[0]]), 10, 64)
+		d, _ := strconv.ParseInt(s[1], 10, 64)
+		f.strings[s[0]] = []byte(strconv.FormatInt(n+d, 10))
+		return n + d
+	case "EXPIRE", "EXPIREAT":
+		f.expires[s[0]], _ = strconv.ParseInt(s[1], 10, 64)
+		return int64(1)
+	case "DEL":
+		var n int64
+		for _, k := range s {
+			if _, ok := f.strings[k]; ok {
+				n++
+			}
+			if _, ok := f.hashes[k]; ok {
+				n++
+			}
+			delete(f.strings, k)
+			delete(f.hashes, k)
+			delete(f.sets, k)
+		}
+		return n
+	case "SADD":
+		if f.sets[s[0]] == nil {
+			f.sets[s[0]] = make(map[string]bool)
+		}
+		for _, m := range s[1:] {
+			f.sets[s[0]][m] = true
+		}
+		return int64(len(s) - 1)
+	case "SREM":
+		for _, m := range s[1:] {
+			delete(f.sets[s[0]], m)
+		}
+		return int64(len(s) - 1)
+	case "SMEMBERS":
+		var ret []interface{}
+		for _, m := range sortedKeys(f.sets[s[0]]) {
+			ret = append(ret, []byte(m))
+		}
+		return ret
+	case "HINCRBY", "HSET":
+		if f.hashes[s[0]] == nil {
+			f.hashes[s[0]] = make(map[string]int64)
+		}
+		n, _ := strconv.ParseInt(s[2], 10, 64)
+		if cmd == "HINCRBY" {
+			n += f.hashes[s[0]][s[1]]
+		}
+		f.hashes[s[0]][s[1]] = n
+		return n
+	case "HDEL":
+		for _, field := range s[1:] {
+			delete(f.hashes[s[0]], field)
+		}
+		return int64(len(s) - 1)
+	case "HGETALL":
+		var ret []interface{}
+		for _, field := range sortedKeys(f.hashes[s[0]]) {
+			ret = append(ret, []byte(field), []byte(strconv.FormatInt(f.hashes[s[0]][field], 10)))
+		}
+		return ret
+	case "PUBLISH":
+		f.published[s[0]] = append(f.published[s[0]], []byte(s[1]))
+		return int64(0)
+	case "SCAN":
+		var keys []interface{}
+		for _, k := range sortedKeys(f.strings) {
+			if ok, _ := filepath.Match(s[2], k); ok {
+				keys = append(keys, []byte(k))
+			}
+		}
+		return []interface{}{[]byte("0"), keys}
+	}
+	return redis.Error("ERR unknown command '" + cmd + "'")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -2,21 +2,30 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/luno/gridlock/api"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 )
 
 type Level string
 
+// changesChannel is published to with the stats whenever traffic is stored,
+// see Keyspace.ChangesChannel
+const changesChannel = "gridlock.changes"
+
 const (
 	Good    = "good"
 	Warning = "warning"
 	Bad     = "bad"
+
+	// Latency keys hold a histogram of call durations rather than a count
+	Latency = "latency"
 )
 
 // TrafficKey is stored as a '.' separated key with an integer count value
@@ -35,16 +44,16 @@ func trafficKeyFromRedis(s string) (TrafficKey, error) {
 	}
 	from, to, trans, bucket, level := p[0], p[1], p[2], p[3], p[4]
 
-	unix, err := strconv.ParseInt(bucket, 10, 64)
+	b, err := bucketFromRedis(bucket)
 	if err != nil {
-		return TrafficKey{}, errors.Wrap(err, "invalid timestamp", j.KV("value", bucket))
+		return TrafficKey{}, err
 	}
-	b := Bucket{time.Unix(unix, 0)}
 	l := Level(level)
 	switch level {
 	case Good:
 	case Warning:
 	case Bad:
+	case Latency:
 	default:
 		return TrafficKey{}, errors.New("invalid level", j.KV("value", level))
 	}
@@ -55,38 +64,257 @@ func trafficKeyFromRedis(s string) (TrafficKey, error) {
 	}, nil
 }
 
+func (ks Keyspace) trafficKey(k TrafficKey) string {
+	return ks.Prefix + trafficKeyToRedis(k)
+}
+
 func trafficKeyToRedis(k TrafficKey) string {
 	parts := []string{
 		k.FromID,
 		k.ToID,
 		k.Transport,
-		strconv.FormatInt(k.Bucket.Unix(), 10),
+		bucketToRedis(k.Bucket),
 		string(k.Level),
 	}
 	return strings.Join(parts, ".")
 }
 
-func StoreTrafficStat(ctx context.Context, conn redis.Conn,
-	k TrafficKey, ttl time.Duration,
-	count int64,
+// TrafficStat is the value of a TrafficKey, Latency is only used by latency keys
+type TrafficStat struct {
+	Key     TrafficKey
+	Count   int64
+	Latency api.Histogram
+}
+
+// StoreTraffic adds the stats into their buckets in the layout and publishes them to
+// ChangesChannel, buckets expire ttl after they start.
+// Everything is sent in a single transaction, so it costs one round trip.
+func StoreTraffic(ctx context.Context, conn redis.Conn, ks Keyspace, layout Layout,
+	stats []TrafficStat, ttl func(Bucket) time.Duration,
 ) error {
-	key := trafficKeyToRedis(k)
-	_, err := redis.DoContext(conn, ctx,
-		"INCRBY", key, count,
-	)
+	return writeTraffic(ctx, conn, ks, layout, stats, ttl, false)
+}
+
+// SetTraffic replaces the stats rather than adding to them, and removes them from the other layout,
+// rollups use it so that they can be recomputed. It doesn't publish any changes.
+func SetTraffic(ctx context.Context, conn redis.Conn, ks Keyspace, layout Layout,
+	stats []TrafficStat, ttl func(Bucket) time.Duration,
+) error {
+	return writeTraffic(ctx, conn, ks, layout, stats, ttl, true)
+}
+
+func writeTraffic(ctx context.Context, conn redis.Conn, ks Keyspace, layout Layout,
+	stats []TrafficStat, ttl func(Bucket) time.Duration,
+	replace bool,
+) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	if err := conn.Send("MULTI"); err != nil {
+		return errors.Wrap(err, "")
+	}
+	buckets := make(map[Bucket][]interface{})
+	for _, s := range stats {
+		var err error
+		switch layout {
+		case LayoutHash:
+			err = sendHashStat(conn, ks, s, replace)
+			if err == nil && replace {
+				err = sendDelKey(conn, ks, s.Key)
+			}
+		default:
+			err = sendKeyStat(conn, ks, s, s.Key.Bucket.Add(ttl(s.Key.Bucket)).Unix(), replace)
+			if err == nil && replace {
+				err = sendDelField(conn, ks, s.Key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		buckets[s.Key.Bucket] = append(buckets[s.Key.Bucket], ks.trafficKey(s.Key))
+	}
+	for b, keys := range buckets {
+		expire := b.Add(ttl(b)).Unix()
+		if layout == LayoutHash {
+			if err := conn.Send("EXPIREAT", ks.hashKey(b), expire); err != nil {
+				return errors.Wrap(err, "")
+			}
+			continue
+		}
+		bk := ks.bucketKey(b)
+		if err := conn.Send("SADD", append([]interface{}{bk}, keys...)...); err != nil {
+			return errors.Wrap(err, "")
+		}
+		if err := conn.Send("EXPIREAT", bk, expire); err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	if !replace {
+		msg, err := encodeChanges(stats)
+		if err != nil {
+			return err
+		}
+		if err := conn.Send("PUBLISH", ks.ChangesChannel(), msg); err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	res, err := redis.Values(redis.DoContext(conn, ctx, "EXEC"))
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
-	expire := k.Bucket.Add(ttl)
-	_, err = redis.DoContext(conn, ctx,
-		"EXPIREAT", key, expire.Unix(),
-	)
-	return errors.Wrap(err, "")
+	// Commands which fail inside a transaction don't fail the EXEC
+	for _, r := range res {
+		if err, ok := r.(redis.Error); ok {
+			return errors.Wrap(err, "")
+		}
+	}
+	return nil
+}
+
+// change is how a TrafficStat is published to the changes channel
+type change struct {
+	Key     string        `json:"key"`
+	Count   int64         `json:"count,omitempty"`
+	Latency api.Histogram `json:"latency,omitempty"`
+}
+
+func encodeChanges(stats []TrafficStat) ([]byte, error) {
+	cl := make([]change, 0, len(stats))
+	for _, s := range stats {
+		cl = append(cl, change{Key: trafficKeyToRedis(s.Key), Count: s.Count, Latency: s.Latency})
+	}
+	b, err := json.Marshal(cl)
+	return b, errors.Wrap(err, "")
+}
+
+// DecodeChanges returns the stats in a message published to the changes channel
+func DecodeChanges(b []byte) ([]TrafficStat, error) {
+	var cl []change
+	if err := json.Unmarshal(b, &cl); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	ret := make([]TrafficStat, 0, len(cl))
+	for _, c := range cl {
+		k, err := trafficKeyFromRedis(c.Key)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, TrafficStat{Key: k, Count: c.Count, Latency: c.Latency})
+	}
+	return ret, nil
+}
+
+func sendKeyStat(conn redis.Conn, ks Keyspace, s TrafficStat, expire int64, replace bool) error {
+	key := ks.trafficKey(s.Key)
+	if s.Key.Level == Latency {
+		return sendLatency(conn, key, expire, s.Latency, replace)
+	}
+	return sendCount(conn, key, expire, s.Count, replace)
+}
+
+func sendCount(conn redis.Conn, key string, expire int64, count int64, replace bool) error {
+	if replace {
+		return errors.Wrap(conn.Send("SET", key, count, "EXAT", expire), "")
+	}
+	if err := conn.Send("INCRBY", key, count); err != nil {
+		return errors.Wrap(err, "")
+	}
+	return errors.Wrap(conn.Send("EXPIREAT", key, expire), "")
 }
 
-func GetTrafficStat(ctx context.Context, conn redis.Conn, key TrafficKey) (int64, error) {
-	i, err := redis.Int64(redis.DoContext(conn, ctx,
-		"GET", trafficKeyToRedis(key),
-	))
-	return i, errors.Wrap(err, "")
+// sendLatency adds the histogram counts into a redis hash keyed by bucket index
+func sendLatency(conn redis.Conn, key string, expire int64, h api.Histogram, replace bool) error {
+	if replace {
+		if err := conn.Send("DEL", key); err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	for i, n := range h {
+		if n == 0 {
+			continue
+		}
+		cmd := "HINCRBY"
+		if replace {
+			cmd = "HSET"
+		}
+		if err := conn.Send(cmd, key, i, n); err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	return errors.Wrap(conn.Send("EXPIREAT", key, expire), "")
+}
+
+// getTraffic reads the values of keys stored in LayoutKeys, counts are fetched with
+// a single MGET and latencies are pipelined with it so that it costs one round trip.
+// Keys which don't exist have zero values.
+func getTraffic(ctx context.Context, conn redis.Conn, ks Keyspace, keys []TrafficKey) ([]TrafficStat, error) {
+	ret := make([]TrafficStat, len(keys))
+	var counts, latencies []int
+	var countKeys []interface{}
+	for i, k := range keys {
+		ret[i].Key = k
+		if k.Level == Latency {
+			latencies = append(latencies, i)
+		} else {
+			counts = append(counts, i)
+			countKeys = append(countKeys, ks.trafficKey(k))
+		}
+	}
+	if len(counts) > 0 {
+		if err := conn.Send("MGET", countKeys...); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+	for _, i := range latencies {
+		if err := conn.Send("HGETALL", ks.trafficKey(keys[i])); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	if len(counts) > 0 {
+		vals, err := redis.Values(redis.ReceiveContext(conn, ctx))
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		for j, v := range vals {
+			if v == nil {
+				continue
+			}
+			n, err := redis.Int64(v, nil)
+			if err != nil {
+				return nil, errors.Wrap(err, "")
+			}
+			ret[counts[j]].Count = n
+		}
+	}
+	for _, i := range latencies {
+		m, err := redis.Int64Map(redis.ReceiveContext(conn, ctx))
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		h, err := histogramFromRedis(m)
+		if err != nil {
+			return nil, err
+		}
+		ret[i].Latency = h
+	}
+	return ret, nil
+}
+
+func histogramFromRedis(m map[string]int64) (api.Histogram, error) {
+	var h api.Histogram
+	for idx, n := range m {
+		i, err := strconv.Atoi(idx)
+		if err != nil || i < 0 || i >= api.HistogramBuckets {
+			return nil, errors.New("invalid histogram bucket", j.KV("value", idx))
+		}
+		if i >= len(h) {
+			h = append(h, make(api.Histogram, i-len(h)+1)...)
+		}
+		h[i] += n
+	}
+	return h, nil
 }
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBucket = Bucket{time.Unix(1700000040, 0), DefaultBucketDuration}
+
+func testTTL(Bucket) time.Duration {
+	return time.Hour
+}
+
+func testKey(from string, l Level) TrafficKey {
+	return TrafficKey{FromID: from, ToID: "b", Transport: "http", Bucket: testBucket, Level: l}
+}
+
+func TestStoreTrafficPipelined(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	ks := Keyspace{Prefix: "gl."}
+
+	stats := []TrafficStat{
+		{Key: testKey("a", Good), Count: 10},
+		{Key: testKey("a", Bad), Count: 1},
+		{Key: testKey("a", Latency), Latency: api.Histogram{0, 2, 3}},
+		{Key: testKey("c", Good), Count: 5},
+	}
+	jtest.RequireNil(t, StoreTraffic(ctx, conn, ks, LayoutKeys, stats, testTTL))
+	jtest.RequireNil(t, StoreTraffic(ctx, conn, ks, LayoutKeys, stats[:1], testTTL))
+	assert.Equal(t, 2, conn.roundTrips)
+
+	assert.Equal(t, "20", string(conn.strings["gl.a.b.http.1700000040.good"]))
+	assert.Equal(t, map[string]int64{"1": 2, "2": 3}, conn.hashes["gl.a.b.http.1700000040.latency"])
+	assert.Len(t, conn.sets["gl.1700000040"], 4)
+	expire := testBucket.Add(time.Hour).Unix()
+	assert.Equal(t, expire, conn.expires["gl.1700000040"])
+	assert.Equal(t, expire, conn.expires["gl.a.b.http.1700000040.good"])
+
+	// Every store is published
+	msgs := conn.published["gl.gridlock.changes"]
+	require.Len(t, msgs, 2)
+	changes, err := DecodeChanges(msgs[0])
+	jtest.RequireNil(t, err)
+	assert.Equal(t, stats, changes)
+
+	conn.roundTrips = 0
+	got, err := GetBucket(ctx, conn, ks, testBucket)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, 2, conn.roundTrips)
+	assert.ElementsMatch(t, []TrafficStat{
+		{Key: testKey("a", Good), Count: 20},
+		{Key: testKey("a", Bad), Count: 1},
+		{Key: testKey("a", Latency), Latency: api.Histogram{0, 2, 3}},
+		{Key: testKey("c", Good), Count: 5},
+	}, got)
+}
+
+func TestSetTrafficReplaces(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	var ks Keyspace
+
+	stats := []TrafficStat{
+		{Key: testKey("a", Good), Count: 10},
+		{Key: testKey("a", Latency), Latency: api.Histogram{0, 2, 3}},
+	}
+	jtest.RequireNil(t, StoreTraffic(ctx, conn, ks, LayoutKeys, stats, testTTL))
+	stats = []TrafficStat{
+		{Key: testKey("a", Good), Count: 4},
+		{Key: testKey("a", Latency), Latency: api.Histogram{1}},
+	}
+	jtest.RequireNil(t, SetTraffic(ctx, conn, ks, LayoutKeys, stats, testTTL))
+
+	got, err := GetBucket(ctx, conn, ks, testBucket)
+	jtest.RequireNil(t, err)
+	assert.ElementsMatch(t, stats, got)
+
+	// Rollups aren't published
+	assert.Len(t, conn.published[ks.ChangesChannel()], 1)
+}
+
+func TestGetTrafficMissingKeys(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	var ks Keyspace
+
+	keys := []TrafficKey{testKey("a", Good), testKey("a", Latency), testKey("a", Bad)}
+	got, err := getTraffic(ctx, conn, ks, keys)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, 1, conn.roundTrips)
+	assert.Equal(t, []TrafficStat{{Key: keys[0]}, {Key: keys[1]}, {Key: keys[2]}}, got)
+}
+
+func TestDecodeChanges(t *testing.T) {
+	testCases := []struct {
+		name   string
+		msg    string
+		exp    []TrafficStat
+		expErr bool
+	}{
+		{name: "empty", msg: "[]", exp: []TrafficStat{}},
+		{
+			name: "count",
+			msg:  `[{"key":"a.b.http.1700000040.good","count":3}]`,
+			exp:  []TrafficStat{{Key: testKey("a", Good), Count: 3}},
+		},
+		{
+			name: "latency",
+			msg:  `[{"key":"a.b.http.1700000040.latency","latency":[0,2]},{"key":"c.b.http.1700000040.bad","count":1}]`,
+			exp: []TrafficStat{
+				{Key: testKey("a", Latency), Latency: api.Histogram{0, 2}},
+				{Key: testKey("c", Bad), Count: 1},
+			},
+		},
+		{name: "invalid json", msg: `{"key"`, expErr: true},
+		{name: "invalid key", msg: `[{"key":"a.b.1700000040.good","count":3}]`, expErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := DecodeChanges([]byte(tc.msg))
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			jtest.RequireNil(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestEncodeChanges(t *testing.T) {
+	stats := []TrafficStat{
+		{Key: testKey("a", Good), Count: 3},
+		{Key: testKey("a", Latency), Latency: api.Histogram{0, 2}},
+	}
+	b, err := encodeChanges(stats)
+	jtest.RequireNil(t, err)
+	act, err := DecodeChanges(b)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, stats, act)
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/luno/jettison/errors"
+)
+
+// watermarkKey holds how far the rollup at resolution has been compacted
+func (ks Keyspace) watermarkKey(resolution time.Duration) string {
+	return ks.Prefix + "gridlock.compacted." + strconv.FormatInt(int64(resolution/time.Second), 10)
+}
+
+// GetWatermark returns the first bucket of the rollup at resolution which may still need compacting,
+// ok is false when the rollup hasn't been compacted before
+func GetWatermark(ctx context.Context, conn redis.Conn, ks Keyspace, resolution time.Duration) (Bucket, bool, error) {
+	unix, err := redis.Int64(redis.DoContext(conn, ctx, "GET", ks.watermarkKey(resolution)))
+	if errors.Is(err, redis.ErrNil) {
+		return Bucket{}, false, nil
+	} else if err != nil {
+		return Bucket{}, false, errors.Wrap(err, "get watermark")
+	}
+	return Bucket{time.Unix(unix, 0), resolution}, true, nil
+}
+
+// SetWatermark records that the buckets of b's rollup before b don't need compacting again
+func SetWatermark(ctx context.Context, conn redis.Conn, ks Keyspace, b Bucket) error {
+	_, err := redis.DoContext(conn, ctx, "SET", ks.watermarkKey(b.Duration), b.Unix())
+	return errors.Wrap(err, "set watermark")
+}
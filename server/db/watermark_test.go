@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermark(t *testing.T) {
+	ctx := context.Background()
+	conn := newFakeRedis()
+	ks := Keyspace{Prefix: "gl."}
+
+	_, ok, err := GetWatermark(ctx, conn, ks, time.Hour)
+	jtest.RequireNil(t, err)
+	assert.False(t, ok)
+
+	b := BucketFromTime(time.Unix(1704110400, 0), time.Hour)
+	jtest.RequireNil(t, SetWatermark(ctx, conn, ks, b))
+	assert.Equal(t, "1704110400", string(conn.strings["gl.gridlock.compacted.3600"]))
+
+	act, ok, err := GetWatermark(ctx, conn, ks, time.Hour)
+	jtest.RequireNil(t, err)
+	assert.True(t, ok)
+	assert.True(t, b.Equal(act.Time))
+	assert.Equal(t, b.Duration, act.Duration)
+
+	// Each rollup has its own
+	_, ok, err = GetWatermark(ctx, conn, ks, 10*time.Minute)
+	jtest.RequireNil(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/server/ops/config"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// maxSignatureAge limits how long a signed request can be replayed for
+const maxSignatureAge = 5 * time.Minute
+
+var (
+	errMissingCredentials = errors.New("missing credentials", j.C("ERR_89dc8cb524d3d98a"))
+	errInvalidToken       = errors.New("invalid bearer token", j.C("ERR_70b8a355be2254ed"))
+	errInvalidSignature   = errors.New("invalid signature", j.C("ERR_2998c537fa3439dc"))
+	errExpiredSignature   = errors.New("expired signature", j.C("ERR_1522f83105fb501f"))
+)
+
+// authenticate checks the credentials sent with a submission,
+// body is the request body as it was sent. It returns which of the configured
+// credentials matched, or an empty identity when auth is disabled.
+func authenticate(a config.Auth, h http.Header, body []byte, now time.Time) (string, error) {
+	if !a.Enabled() {
+		return "", nil
+	}
+	if token, ok := bearerToken(h.Get("Authorization")); ok {
+		return checkToken(a, token)
+	}
+	if sig := h.Get(api.HeaderSignature); sig != "" {
+		return checkSignature(a, sig, h.Get(api.HeaderSignatureTimestamp), body, now)
+	}
+	return "", errMissingCredentials
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return header[len(prefix):], true
+}
+
+// checkToken returns the identity of the matching token, named by its position so the secret isn't exposed
+func checkToken(a config.Auth, token string) (string, error) {
+	for i, t := range a.BearerTokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return "token." + strconv.Itoa(i), nil
+		}
+	}
+	return "", errInvalidToken
+}
+
+// checkSignature returns the identity of the key which signed body, named like checkToken
+func checkSignature(a config.Auth, sig, timestamp string, body []byte, now time.Time) (string, error) {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", errInvalidSignature
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return "", errExpiredSignature
+	}
+	for i, k := range a.HMACKeys {
+		exp := api.SignSubmission([]byte(k), ts, body)
+		if hmac.Equal([]byte(exp), []byte(sig)) {
+			return "hmac." + strconv.Itoa(i), nil
+		}
+	}
+	return "", errInvalidSignature
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/api/gridlockpb"
+	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/gridlock/server/ops/config"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultWatchInterval = 10 * time.Second
+	minWatchInterval     = time.Second
+)
+
+type grpcService struct {
+	gridlockpb.UnimplementedGridlockServer
+	Deps
+}
+
+// RegisterGRPCService adds the gridlock service to s, backed by the same Deps as the HTTP API.
+// Use GRPCServerOptions when creating the server to apply the configured message size limit.
+func RegisterGRPCService(s grpc.ServiceRegistrar, d Deps) {
+	gridlockpb.RegisterGridlockServer(s, &grpcService{Deps: d})
+}
+
+// GRPCServerOptions returns the server options needed to enforce the configured limits
+func GRPCServerOptions() []grpc.ServerOption {
+	lim := config.GetConfig().Limits.WithDefaults()
+	return []grpc.ServerOption{grpc.MaxRecvMsgSize(int(lim.MaxBodyBytes))}
+}
+
+func (s *grpcService) SubmitMetrics(ctx context.Context, req *gridlockpb.SubmitMetrics) (*gridlockpb.SubmitMetricsResponse, error) {
+	lim := config.GetConfig().Limits.WithDefaults()
+	identity, err := authenticateGRPC(ctx, config.GetConfig().Auth)
+	if err != nil {
+		submitRejected.WithLabelValues(rejectReason(err)).Inc()
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	sub := api.SubmitMetricsFromProto(req)
+	err = checkSubmission(lim, sub, time.Now())
+	if errors.Is(err, errTooManyMetrics) {
+		submitRejected.WithLabelValues(rejectReason(err)).Inc()
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	} else if err != nil {
+		submitRejected.WithLabelValues(rejectReason(err)).Inc()
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	if !submitLimiter.Allow(limitKey(identity, addr), time.Now(), lim) {
+		submitRejected.WithLabelValues("rate_limited").Inc()
+		return nil, status.Error(codes.ResourceExhausted, "too many requests")
+	}
+	err = s.TrafficStats().Record(ctx, sub.Metrics...)
+	if err != nil {
+		log.Error(ctx, errors.Wrap(err, "submit metrics"))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &gridlockpb.SubmitMetricsResponse{}, nil
+}
+
+// authenticateGRPC checks for a bearer token in the call's metadata, returning its identity like authenticate.
+// Signed requests are only supported over HTTP.
+func authenticateGRPC(ctx context.Context, a config.Auth) (string, error) {
+	if !a.Enabled() {
+		return "", nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if token, ok := bearerToken(v); ok {
+			return checkToken(a, token)
+		}
+	}
+	return "", errMissingCredentials
+}
+
+func (s *grpcService) GetTraffic(req *gridlockpb.GetTrafficRequest, stream gridlockpb.Gridlock_GetTrafficServer) error {
+	var ts time.Time
+	if req.GetTs() != 0 {
+		ts = time.Unix(req.GetTs(), 0)
+	}
+	t := s.TrafficStats().GetMetricLog()
+	for _, traffic := range ops.SummariseTraffic(t, ts) {
+		if err := stream.Send(traffic.ToProto()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchGraph sends the vizceral graph every interval until the caller goes away
+func (s *grpcService) WatchGraph(req *gridlockpb.WatchGraphRequest, stream gridlockpb.Gridlock_WatchGraphServer) error {
+	window := time.Duration(req.GetWindow())
+	if window <= 0 {
+		window = defaultGraphWindow
+	}
+	interval := time.Duration(req.GetInterval())
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	interval = max(interval, minWatchInterval)
+
+	ctx := stream.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		to := time.Now()
+		from := to.Add(-window)
+		t, err := s.TrafficStats().GetMetricLogBetween(ctx, from, to)
+		if errors.Is(err, ops.ErrRangeTooLarge) {
+			return status.Error(codes.InvalidArgument, err.Error())
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "watch graph"))
+			return status.Error(codes.Internal, "internal error")
+		}
+		g := ops.CompileVizceralGraph(t, from, to)
+		if err := stream.Send(g.ToProto()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/gridlock/server/ops/config"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+var (
+	errTooLarge       = errors.New("submission too large", j.C("ERR_43d455302af41142"))
+	errTooManyMetrics = errors.New("too many metrics", j.C("ERR_77c3a0cf0cbcfae3"))
+)
+
+// checkSubmission applies the configured limits and validation to a decoded submission
+func checkSubmission(l config.Limits, req api.SubmitMetrics, now time.Time) error {
+	if len(req.Metrics) > l.MaxMetrics {
+		return errors.Wrap(errTooManyMetrics, fmt.Sprintf("%d metrics, max %d", len(req.Metrics), l.MaxMetrics))
+	}
+	for i, m := range req.Metrics {
+		if err := ops.ValidateMetrics(m, now); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("metric %d", i))
+		}
+	}
+	return nil
+}
+
+// submitLimiter is shared by the HTTP and gRPC APIs, so a submitter gets the same limit over either
+var submitLimiter = newRateLimiter()
+
+// rateLimiter keeps a token bucket for each submitter, see limitKey
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token for key, returning false if there are none left.
+// It always succeeds when the limits don't set a rate.
+func (l *rateLimiter) Allow(key string, now time.Time, lim config.Limits) bool {
+	if lim.SubmitRate <= 0 {
+		return true
+	}
+	burst := float64(lim.SubmitBurst)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > time.Minute {
+		l.prune(now, lim.SubmitRate, burst)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*lim.SubmitRate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune forgets submitters whose buckets have refilled, they behave the same as new ones
+func (l *rateLimiter) prune(now time.Time, rate, burst float64) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastPrune = now
+}
+
+// limitKey identifies who a submission is limited as. Authenticated submissions
+// share the limit of their credential, otherwise they're limited by the peer's address.
+func limitKey(identity, addr string) string {
+	if identity != "" {
+		return identity
+	}
+	host := remoteHost(addr)
+	if host == "" {
+		return "peer.unknown"
+	}
+	return "peer." + host
+}
+
+// remoteHost removes the port from addr, if it has one
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -9,6 +9,13 @@ var httpHandle = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 	Help:      "Handled HTTP request latency",
 }, []string{"path"})
 
+var submitRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "gridlock",
+	Subsystem: "server",
+	Name:      "submit_rejected_total",
+	Help:      "Submissions rejected before their metrics were stored",
+}, []string{"reason"})
+
 func init() {
-	prometheus.MustRegister(httpHandle)
+	prometheus.MustRegister(httpHandle, submitRejected)
 }
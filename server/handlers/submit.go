@@ -1,33 +1,81 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/api/gridlockpb"
+	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/gridlock/server/ops/config"
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
+	"google.golang.org/protobuf/proto"
 )
 
+var errUnsupportedEncoding = errors.New("unsupported content encoding", j.C("ERR_bdf9ca5b9d5b2a63"))
+
 func SubmitMetricsHandler(d Deps) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		if r.Header.Get("Content-Type") != "application/json" {
+		lim := config.GetConfig().Limits.WithDefaults()
+		raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, lim.MaxBodyBytes))
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			submitRejected.WithLabelValues(rejectReason(errTooLarge)).Inc()
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		var req api.SubmitMetrics
-		b, err := io.ReadAll(r.Body)
+		identity, err := authenticate(config.GetConfig().Auth, r.Header, raw, time.Now())
 		if err != nil {
+			submitRejected.WithLabelValues(rejectReason(err)).Inc()
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		b, err := decodeBody(r.Header.Get("Content-Encoding"), raw, lim.MaxBodyBytes)
+		if errors.Is(err, errUnsupportedEncoding) {
+			http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+			return
+		} else if errors.Is(err, errTooLarge) {
+			submitRejected.WithLabelValues(rejectReason(err)).Inc()
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		err = json.Unmarshal(b, &req)
+		req, err := decodeSubmission(r.Header.Get("Content-Type"), b)
 		if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
+		err = checkSubmission(lim, req, time.Now())
+		if err != nil {
+			submitRejected.WithLabelValues(rejectReason(err)).Inc()
+			code := http.StatusBadRequest
+			if errors.Is(err, errTooManyMetrics) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		if !submitLimiter.Allow(limitKey(identity, r.RemoteAddr), time.Now(), lim) {
+			submitRejected.WithLabelValues("rate_limited").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/lim.SubmitRate))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
 		ctx := r.Context()
 		err = d.TrafficStats().Record(ctx, req.Metrics...)
 		if err != nil {
@@ -36,3 +84,67 @@ func SubmitMetricsHandler(d Deps) httprouter.Handle {
 		}
 	}
 }
+
+// decodeBody removes the content encoding from b, limiting how much it can expand to
+func decodeBody(contentEncoding string, b []byte, maxBytes int64) ([]byte, error) {
+	switch contentEncoding {
+	case "", "identity":
+		return b, nil
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		ret, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(ret)) > maxBytes {
+			return nil, errTooLarge
+		}
+		return ret, nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+func decodeSubmission(contentType string, b []byte) (api.SubmitMetrics, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return api.SubmitMetrics{}, errors.Wrap(err, "content type")
+	}
+	var req api.SubmitMetrics
+	switch mediaType {
+	case api.ContentTypeJSON:
+		err = json.Unmarshal(b, &req)
+	case api.ContentTypeProto:
+		var p gridlockpb.SubmitMetrics
+		err = proto.Unmarshal(b, &p)
+		req = api.SubmitMetricsFromProto(&p)
+	default:
+		err = errors.New("unsupported content type")
+	}
+	return req, err
+}
+
+// rejectReason labels a rejected submission in submitRejected
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, errMissingCredentials):
+		return "missing_credentials"
+	case errors.Is(err, errInvalidToken):
+		return "invalid_token"
+	case errors.Is(err, errInvalidSignature):
+		return "invalid_signature"
+	case errors.Is(err, errExpiredSignature):
+		return "expired_signature"
+	case errors.Is(err, errTooLarge):
+		return "too_large"
+	case errors.Is(err, errTooManyMetrics):
+		return "too_many_metrics"
+	case errors.Is(err, ops.ErrInvalidMetrics):
+		return "invalid_metrics"
+	default:
+		return "unknown"
+	}
+}
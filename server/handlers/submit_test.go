@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/gridlock/server/ops/config"
+)
+
+type state struct {
+	Log ops.TrafficStats
+}
+
+func (s state) TrafficStats() ops.TrafficStats {
+	return s.Log
+}
+
+func submission(t *testing.T, metrics ...api.Metrics) []byte {
+	b, err := json.Marshal(api.SubmitMetrics{Metrics: metrics})
+	require.NoError(t, err)
+	return b
+}
+
+func TestSubmitLimits(t *testing.T) {
+	ts := time.Now().Unix()
+	m := api.Metrics{Source: "a", Target: "b", Timestamp: ts, Duration: time.Minute, CountGood: 1}
+	other := api.Metrics{Source: "c", Target: "b", Timestamp: ts, Duration: time.Minute, CountGood: 1}
+
+	testCases := []struct {
+		name      string
+		limits    config.Limits
+		auth      config.Auth
+		token     string
+		addr      []string
+		body      [][]byte
+		expStatus []int
+	}{
+		{
+			name:      "accepted",
+			body:      [][]byte{submission(t, m)},
+			expStatus: []int{http.StatusOK},
+		},
+		{
+			name:      "body too large",
+			limits:    config.Limits{MaxBodyBytes: 10},
+			body:      [][]byte{submission(t, m)},
+			expStatus: []int{http.StatusRequestEntityTooLarge},
+		},
+		{
+			name:      "too many metrics",
+			limits:    config.Limits{MaxMetrics: 1},
+			body:      [][]byte{submission(t, m, m)},
+			expStatus: []int{http.StatusRequestEntityTooLarge},
+		},
+		{
+			name:      "invalid metrics",
+			body:      [][]byte{submission(t, api.Metrics{Source: "a", CountGood: -1})},
+			expStatus: []int{http.StatusBadRequest},
+		},
+		{
+			name:      "metric too long",
+			body:      [][]byte{submission(t, api.Metrics{Source: "a", Target: "b", Timestamp: ts, Duration: 365 * 24 * time.Hour})},
+			expStatus: []int{http.StatusBadRequest},
+		},
+		{
+			name:      "rate limited",
+			limits:    config.Limits{SubmitRate: 0.1, SubmitBurst: 2},
+			body:      [][]byte{submission(t, m), submission(t, m), submission(t, m)},
+			expStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "peer limited across sources",
+			limits:    config.Limits{SubmitRate: 0.1, SubmitBurst: 1},
+			body:      [][]byte{submission(t, m), submission(t, other)},
+			expStatus: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "peers limited separately",
+			limits:    config.Limits{SubmitRate: 0.1, SubmitBurst: 1},
+			addr:      []string{"10.0.0.1:1000", "10.0.0.2:1000", "10.0.0.1:2000"},
+			body:      [][]byte{submission(t, m), submission(t, m), submission(t, m)},
+			expStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "credential limited across sources",
+			limits:    config.Limits{SubmitRate: 0.1, SubmitBurst: 1},
+			auth:      config.Auth{BearerTokens: []string{"secret"}},
+			token:     "secret",
+			body:      [][]byte{submission(t, m), submission(t, other)},
+			expStatus: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.SetConfig(config.Config{Limits: tc.limits, Auth: tc.auth})
+			t.Cleanup(func() { config.SetConfig(config.Config{}) })
+			submitLimiter = newRateLimiter()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			db := ops.NewMemDB()
+			h := SubmitMetricsHandler(state{Log: ops.NewLoader(ctx, db, db)})
+
+			for i, b := range tc.body {
+				req := httptest.NewRequest(http.MethodPost, "/gridlock/api/submit", bytes.NewReader(b))
+				req.Header.Set("Content-Type", api.ContentTypeJSON)
+				if tc.addr != nil {
+					req.RemoteAddr = tc.addr[i]
+				}
+				if tc.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tc.token)
+				}
+				w := httptest.NewRecorder()
+				h(w, req, httprouter.Params{})
+				assert.Equal(t, tc.expStatus[i], w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLimitKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		identity string
+		addr     string
+		exp      string
+	}{
+		{name: "unknown peer", exp: "peer.unknown"},
+		{name: "identity", identity: "token.1", addr: "10.0.0.1:1000", exp: "token.1"},
+		{name: "peer", addr: "10.0.0.1:1000", exp: "peer.10.0.0.1"},
+		{name: "ipv6 peer", addr: "[::1]:1000", exp: "peer.::1"},
+		{name: "no port", addr: "10.0.0.1", exp: "peer.10.0.0.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, limitKey(tc.identity, tc.addr))
+		})
+	}
+}
@@ -3,34 +3,86 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/luno/gridlock/api"
 	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/log"
 )
 
+// defaultTrafficWindow is the range of traffic returned when only the end of the range is given
+const defaultTrafficWindow = time.Hour
+
+// GetTrafficHandler serves traffic per bucket, either for the loaded traffic, a single
+// bucket with ts, or a range with from, to and window. It can be filtered by source, target,
+// region, transport and (node) type, aggregate=true sums each edge over the whole range
+// and limit and offset page through the results.
 func GetTrafficHandler(d Deps) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := r.Context()
-		t := d.TrafficStats().GetMetricLog()
-
 		q := r.URL.Query()
-		var ts time.Time
-		if q.Has("ts") {
-			unixTs, err := strconv.ParseInt(q.Get("ts"), 10, 64)
+
+		var tq ops.TrafficQuery
+		var t []api.Metrics
+		if q.Has("from") || q.Has("to") || q.Has("window") {
+			if q.Has("ts") {
+				http.Error(w, "ts can't be used with a range", http.StatusBadRequest)
+				return
+			}
+			from, to, err := timeRange(q, time.Now(), defaultTrafficWindow)
 			if err != nil {
-				http.Error(w, "Bad ts parameter", http.StatusBadRequest)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			t, err = d.TrafficStats().GetMetricLogBetween(ctx, from, to)
+			if errors.Is(err, ops.ErrRangeTooLarge) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
+			} else if err != nil {
+				log.Error(ctx, err)
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			tq.From, tq.To = from, to
+		} else {
+			t = d.TrafficStats().GetMetricLog()
+			if q.Has("ts") {
+				unixTs, err := strconv.ParseInt(q.Get("ts"), 10, 64)
+				if err != nil {
+					http.Error(w, "Bad ts parameter", http.StatusBadRequest)
+					return
+				}
+				ts := time.Unix(unixTs, 0)
+				tq.From, tq.To = ts, ts.Add(time.Nanosecond)
 			}
-			ts = time.Unix(unixTs, 0)
 		}
-
-		resp := api.GetTrafficResponse{
-			Traffic: ops.SummariseTraffic(t, ts),
+		tq.Filter = ops.TrafficFilter{
+			Source:    q.Get("source"),
+			Target:    q.Get("target"),
+			Region:    q.Get("region"),
+			Transport: api.Transport(q.Get("transport")),
+			Type:      api.NodeType(q.Get("type")),
+		}
+		if q.Has("aggregate") {
+			agg, err := strconv.ParseBool(q.Get("aggregate"))
+			if err != nil {
+				http.Error(w, "Bad aggregate parameter", http.StatusBadRequest)
+				return
+			}
+			tq.Aggregate = agg
 		}
+		limit, offset, err := pageParams(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var resp api.GetTrafficResponse
+		resp.Traffic, resp.NextOffset = page(ops.QueryTraffic(t, tq), limit, offset)
 		respBytes, err := json.Marshal(resp)
 		if err != nil {
 			log.Error(ctx, err)
@@ -44,3 +96,35 @@ func GetTrafficHandler(d Deps) httprouter.Handle {
 		}
 	}
 }
+
+// pageParams reads limit and offset, a zero limit returns everything
+func pageParams(q url.Values) (int, int, error) {
+	var limit, offset int
+	if q.Has("limit") {
+		l, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || l < 0 {
+			return 0, 0, errors.New("Bad limit parameter")
+		}
+		limit = l
+	}
+	if q.Has("offset") {
+		o, err := strconv.Atoi(q.Get("offset"))
+		if err != nil || o < 0 {
+			return 0, 0, errors.New("Bad offset parameter")
+		}
+		offset = o
+	}
+	return limit, offset, nil
+}
+
+// page returns the slice of traffic after offset and the offset of the next page, if there is one
+func page(t []api.Traffic, limit, offset int) ([]api.Traffic, int) {
+	if offset >= len(t) {
+		return nil, 0
+	}
+	t = t[offset:]
+	if limit == 0 || limit >= len(t) {
+		return t, 0
+	}
+	return t[:limit], offset + limit
+}
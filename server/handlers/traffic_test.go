@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestPage(t *testing.T) {
+	traffic := []api.Traffic{{From: "a"}, {From: "b"}, {From: "c"}}
+	testCases := []struct {
+		name       string
+		limit      int
+		offset     int
+		expTraffic []api.Traffic
+		expNext    int
+	}{
+		{name: "everything", expTraffic: traffic},
+		{name: "first page", limit: 2, expTraffic: traffic[:2], expNext: 2},
+		{name: "last page", limit: 2, offset: 2, expTraffic: traffic[2:]},
+		{name: "exact page", limit: 3, expTraffic: traffic},
+		{name: "past the end", limit: 2, offset: 5},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, next := page(traffic, tc.limit, tc.offset)
+			assert.Equal(t, tc.expTraffic, res)
+			assert.Equal(t, tc.expNext, next)
+		})
+	}
+}
@@ -4,20 +4,42 @@ import (
 	_ "embed"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/luno/gridlock/server/ops"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
 )
 
+// defaultGraphWindow is how much recent traffic is included in the graph
+const defaultGraphWindow = 5 * time.Minute
+
+var errBadRange = errors.New("bad time range", j.C("ERR_6591dd7f342a1bae"))
+
+// VizceralTrafficHandler serves the graph for the last five minutes,
+// or for the range given by the from, to and window parameters
 func VizceralTrafficHandler(d Deps) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := r.Context()
-		t := d.TrafficStats().GetMetricLog()
 
-		to := time.Now()
-		from := to.Add(-5 * time.Minute)
+		from, to, err := timeRange(r.URL.Query(), time.Now(), defaultGraphWindow)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t, err := d.TrafficStats().GetMetricLogBetween(ctx, from, to)
+		if errors.Is(err, ops.ErrRangeTooLarge) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Error(ctx, err)
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
 
 		g := ops.CompileVizceralGraph(t, from, to)
 		b, err := json.Marshal(g)
@@ -33,3 +55,55 @@ func VizceralTrafficHandler(d Deps) httprouter.Handle {
 		}
 	}
 }
+
+// timeRange reads from and to as unix timestamps and window as a duration, e.g. "1h".
+// Any two of them define the range, to defaults to now and window to defWindow.
+func timeRange(q url.Values, now time.Time, defWindow time.Duration) (time.Time, time.Time, error) {
+	parseTime := func(name string) (time.Time, error) {
+		unix, err := strconv.ParseInt(q.Get(name), 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrap(errBadRange, "bad "+name+" parameter")
+		}
+		return time.Unix(unix, 0), nil
+	}
+
+	var from, to time.Time
+	var err error
+	if q.Has("from") {
+		if from, err = parseTime("from"); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if q.Has("to") {
+		if to, err = parseTime("to"); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	window := defWindow
+	if q.Has("window") {
+		if q.Has("from") && q.Has("to") {
+			return time.Time{}, time.Time{}, errors.Wrap(errBadRange, "window can't be used with both from and to")
+		}
+		window, err = time.ParseDuration(q.Get("window"))
+		if err != nil || window <= 0 {
+			return time.Time{}, time.Time{}, errors.Wrap(errBadRange, "bad window parameter")
+		}
+	}
+
+	switch {
+	case q.Has("from") && q.Has("to"):
+	case q.Has("from") && q.Has("window"):
+		to = from.Add(window)
+	case q.Has("from"):
+		to = now
+	default:
+		if !q.Has("to") {
+			to = now
+		}
+		from = to.Add(-window)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.Wrap(errBadRange, "from must be before to")
+	}
+	return from, to, nil
+}
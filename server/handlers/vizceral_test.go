@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeRange(t *testing.T) {
+	now := time.Unix(1704110400, 0)
+	testCases := []struct {
+		name    string
+		query   string
+		expFrom time.Time
+		expTo   time.Time
+		expErr  error
+	}{
+		{name: "default", expFrom: now.Add(-5 * time.Minute), expTo: now},
+		{name: "window", query: "window=1h", expFrom: now.Add(-time.Hour), expTo: now},
+		{name: "from and to", query: "from=1704020400&to=1704024000", expFrom: time.Unix(1704020400, 0), expTo: time.Unix(1704024000, 0)},
+		{name: "from until now", query: "from=1704020400", expFrom: time.Unix(1704020400, 0), expTo: now},
+		{name: "from and window", query: "from=1704020400&window=10m", expFrom: time.Unix(1704020400, 0), expTo: time.Unix(1704021000, 0)},
+		{name: "to and window", query: "to=1704024000&window=10m", expFrom: time.Unix(1704023400, 0), expTo: time.Unix(1704024000, 0)},
+		{name: "bad from", query: "from=yesterday", expErr: errBadRange},
+		{name: "bad window", query: "window=-1h", expErr: errBadRange},
+		{name: "too many parameters", query: "from=1704020400&to=1704024000&window=1h", expErr: errBadRange},
+		{name: "backwards", query: "from=1704024000&to=1704020400", expErr: errBadRange},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tc.query)
+			jtest.RequireNil(t, err)
+
+			from, to, err := timeRange(q, now, defaultGraphWindow)
+			jtest.Require(t, tc.expErr, err)
+			assert.Equal(t, tc.expFrom, from)
+			assert.Equal(t, tc.expTo, to)
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 	jlog "github.com/luno/jettison/log"
+	"google.golang.org/grpc"
 )
 
 type state struct {
@@ -33,8 +34,10 @@ func main() {
 
 	var port int
 	var debugPort int
+	var grpcPort int
 	flag.IntVar(&port, "port", 80, "Port for the main web server")
 	flag.IntVar(&debugPort, "debug-port", 8080, "Port for the debug web server")
+	flag.IntVar(&grpcPort, "grpc-port", 0, "Port for the gRPC server, disabled when zero")
 	flag.Parse()
 
 	config.MustLoadConfig()
@@ -42,21 +45,28 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	var s state
+	var trafficDB ops.TrafficDB
+	var nodeDB ops.NodeDB
 	pool, err := ops.NewRedisPool(ctx)
 	if err != nil {
 		jlog.Error(ctx, errors.Wrap(err, "failed to connect to redis, falling back to memory db"))
 		mdb := ops.NewMemDB()
-		s.Log = ops.NewLoader(ctx, mdb, mdb)
+		trafficDB, nodeDB = mdb, mdb
 	} else {
-		s.Log = ops.NewLoader(ctx,
-			ops.NewRedisTrafficDB(pool),
-			ops.NewRedisNodeDB(pool),
-		)
+		ks := ops.RedisKeyspace()
+		trafficDB = ops.NewRedisTrafficDB(ctx, pool, ks)
+		nodeDB = ops.NewRedisNodeDB(pool, ks)
 	}
+	s := state{Log: ops.NewLoader(ctx, trafficDB, nodeDB)}
 
 	var wg sync.WaitGroup
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ops.NewCompactor(trafficDB, config.GetConfig().Storage).CompactForever(ctx)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -69,9 +79,42 @@ func main() {
 		runWebServer(ctx, handlers.CreateDebugRouter(), debugPort)
 	}()
 
+	if grpcPort != 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runGRPCServer(ctx, s, grpcPort)
+		}()
+	}
+
 	wg.Wait()
 }
 
+func runGRPCServer(ctx context.Context, d handlers.Deps, port int) {
+	lis, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		panic(err)
+	}
+	srv := grpc.NewServer(handlers.GRPCServerOptions()...)
+	handlers.RegisterGRPCService(srv, d)
+
+	go func() {
+		<-ctx.Done()
+		jlog.Info(ctx, "shutting down grpc server")
+		// Watch streams only end when their callers leave, don't wait forever for them
+		t := time.AfterFunc(10*time.Second, srv.Stop)
+		defer t.Stop()
+		srv.GracefulStop()
+	}()
+
+	jlog.Info(ctx, "grpc server listening", j.KV("port", port))
+	err = srv.Serve(lis)
+	if err != nil {
+		panic(err)
+	}
+	jlog.Info(ctx, "grpc server terminated", j.KV("port", port))
+}
+
 func runWebServer(ctx context.Context, router *httprouter.Router, port int) {
 	srv := &http.Server{
 		BaseContext: func(listener net.Listener) context.Context { return ctx },
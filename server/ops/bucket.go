@@ -2,6 +2,7 @@ package ops
 
 import (
 	"context"
+
 	"github.com/luno/gridlock/server/db"
 	"github.com/luno/gridlock/server/ops/graph"
 )
@@ -9,30 +10,33 @@ import (
 type BucketTraffic map[db.TrafficKey]graph.RateStats
 
 func loadBucket(ctx context.Context, trafficDB TrafficDB, bucket db.Bucket) (BucketTraffic, error) {
-	keys, err := trafficDB.GetBucket(ctx, bucket)
+	stats, err := trafficDB.GetBucket(ctx, bucket)
 	if err != nil {
 		return nil, err
 	}
-	agg := make(map[db.TrafficKey]graph.RateStats)
-	for _, k := range keys {
-		count, err := trafficDB.GetTrafficStat(ctx, k)
-		if err != nil {
-			return nil, err
-		}
-		l := k.Level
-		// Zero the key to aggregate stats
-		k.Level = ""
-		s := agg[k]
-		switch l {
-		case db.Good:
-			s.Good += count
-		case db.Warning:
-			s.Warning += count
-		case db.Bad:
-			s.Bad += count
-		}
-		s.Duration = db.BucketDuration
-		agg[k] = s
+	agg := make(BucketTraffic)
+	for _, st := range stats {
+		agg.add(st)
 	}
 	return agg, nil
 }
+
+// add sums a stat into the traffic of its edge
+func (t BucketTraffic) add(st db.TrafficStat) {
+	k := st.Key
+	// Zero the key to aggregate stats
+	k.Level = ""
+	s := t[k]
+	switch st.Key.Level {
+	case db.Latency:
+		s.Latency = s.Latency.Merge(st.Latency)
+	case db.Good:
+		s.Good += st.Count
+	case db.Warning:
+		s.Warning += st.Count
+	case db.Bad:
+		s.Bad += st.Count
+	}
+	s.Duration = k.Bucket.Duration
+	t[k] = s
+}
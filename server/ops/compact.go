@@ -0,0 +1,143 @@
+package ops
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/gridlock/server/db"
+	"github.com/luno/gridlock/server/ops/config"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// Compactor rolls traffic up into the coarser resolutions configured in config.Storage.
+// Rollups are recomputed from the finer resolution each time so that late traffic is included,
+// as long as it arrives before the rollup bucket after the one it belongs in has finished.
+// Each rollup has a watermark in the TrafficDB, so that buckets missed while compaction
+// wasn't running are caught up on, as long as their traffic hasn't expired.
+// maxCompactBuckets limits how many buckets of each rollup are recomputed by one Compact,
+// so that catching up after an outage is spread over several runs
+const maxCompactBuckets = 30
+
+type Compactor struct {
+	trafficDB TrafficDB
+	storage   config.Storage
+	now       func() time.Time
+}
+
+func NewCompactor(trafficDB TrafficDB, s config.Storage) *Compactor {
+	return &Compactor{trafficDB: trafficDB, storage: s.WithDefaults(), now: time.Now}
+}
+
+// CompactForever compacts every time a bucket at the base resolution finishes
+func (c *Compactor) CompactForever(ctx context.Context) {
+	if len(c.storage.Rollups) == 0 {
+		return
+	}
+	t := time.NewTicker(c.storage.Resolution)
+	defer t.Stop()
+	for {
+		err := c.Compact(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Error(ctx, errors.Wrap(err, "compact traffic"))
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Compact recomputes each rollup from its watermark up to the current bucket,
+// each rollup is built from the one before it so they're done in order
+func (c *Compactor) Compact(ctx context.Context) error {
+	now := c.now()
+	tiers := c.storage.Tiers()
+	upTo := now
+	for i := 1; i < len(tiers); i++ {
+		done, err := c.compactTier(ctx, tiers[i-1], tiers[i].Resolution, now, upTo)
+		if err != nil {
+			return err
+		}
+		// The next rollup can't be finished past what this one has
+		upTo = done.End()
+	}
+	return nil
+}
+
+// compactTier recomputes the rollup at resolution from the tier below, oldest first,
+// from its watermark up to the bucket containing upTo, at most maxCompactBuckets at a time.
+// It returns the new watermark, the buckets before it won't change again.
+func (c *Compactor) compactTier(ctx context.Context, from config.Tier, resolution time.Duration,
+	now, upTo time.Time,
+) (db.Bucket, error) {
+	last := db.BucketFromTime(upTo, resolution)
+	first := last.Previous()
+	wm, ok, err := c.trafficDB.GetWatermark(ctx, resolution)
+	if err != nil {
+		return db.Bucket{}, errors.Wrap(err, "get watermark", j.KV("resolution", resolution))
+	}
+	if ok && wm.Before(first.Time) {
+		first = wm
+	}
+	// Buckets whose traffic has started to expire from the tier below can't be recomputed
+	if oldest := db.BucketFromTime(now.Add(-from.Retention), resolution).Next(); first.Before(oldest.Time) {
+		first = oldest
+	}
+
+	buckets := db.GetBucketsBetween(first.Time, last.Time, resolution)
+	if len(buckets) > maxCompactBuckets {
+		buckets = buckets[:maxCompactBuckets]
+	}
+	done := first
+	for _, b := range buckets {
+		err := c.rollup(ctx, b, from.Resolution)
+		if err != nil {
+			return db.Bucket{}, errors.Wrap(err, "rollup", j.MKV{"bucket": b.Unix(), "resolution": b.Duration})
+		}
+		// The last two buckets are recomputed again, in case traffic arrives late
+		if b.Before(last.Previous().Time) {
+			done = b.Next()
+		}
+	}
+	if err := c.trafficDB.SetWatermark(ctx, done); err != nil {
+		return db.Bucket{}, errors.Wrap(err, "set watermark", j.KV("resolution", resolution))
+	}
+	return done, nil
+}
+
+func (c *Compactor) rollup(ctx context.Context, bucket db.Bucket, from time.Duration) error {
+	traffic := make(BucketTraffic)
+	for _, src := range bucket.Split(from) {
+		bt, err := loadBucket(ctx, c.trafficDB, src)
+		if err != nil {
+			return err
+		}
+		for k, s := range bt {
+			k.Bucket = bucket
+			traffic[k] = traffic[k].Extend(s)
+		}
+	}
+	if len(traffic) == 0 {
+		return nil
+	}
+
+	var stats []db.TrafficStat
+	for k, s := range traffic {
+		counts := []struct {
+			level db.Level
+			count int64
+		}{{db.Good, s.Good}, {db.Warning, s.Warning}, {db.Bad, s.Bad}}
+		for _, lc := range counts {
+			k.Level = lc.level
+			stats = append(stats, db.TrafficStat{Key: k, Count: lc.count})
+		}
+		if s.Latency.Count() > 0 {
+			k.Level = db.Latency
+			stats = append(stats, db.TrafficStat{Key: k, Latency: s.Latency})
+		}
+	}
+	return c.trafficDB.SetTraffic(ctx, stats)
+}
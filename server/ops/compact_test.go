@@ -0,0 +1,123 @@
+package ops
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/server/db"
+	"github.com/luno/gridlock/server/ops/config"
+	"github.com/luno/gridlock/server/ops/graph"
+)
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemDB()
+	t0 := time.Unix(1704110400, 0) // 2024-01-01 12:00 UTC
+
+	c := NewCompactor(mdb, config.Storage{
+		Resolution: time.Minute,
+		Retention:  24 * time.Hour,
+		Rollups: []config.Tier{
+			{Resolution: 10 * time.Minute, Retention: 7 * 24 * time.Hour},
+			{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+		},
+	})
+	m := api.Metrics{
+		Source: "a", Target: "b", Transport: api.TransportHTTP,
+		Duration: time.Minute, CountGood: 10, CountBad: 1,
+		Latency: api.Histogram{}.Add(time.Millisecond, 1),
+	}
+	for _, mins := range []int{5, 12, 15, 24} {
+		m.Timestamp = t0.Add(time.Duration(mins) * time.Minute).Unix()
+		jtest.RequireNil(t, storeMetrics(ctx, mdb, mdb, time.Minute, []api.Metrics{m}))
+	}
+
+	// Compacting repeatedly doesn't count anything twice
+	for _, mins := range []int{5, 15, 25, 25} {
+		c.now = func() time.Time { return t0.Add(time.Duration(mins) * time.Minute) }
+		jtest.RequireNil(t, c.Compact(ctx))
+	}
+
+	stats := func(b db.Bucket) []graph.RateStats {
+		bt, err := loadBucket(ctx, mdb, b)
+		jtest.RequireNil(t, err)
+		var ret []graph.RateStats
+		for _, s := range bt {
+			s.Latency = nil
+			ret = append(ret, s)
+		}
+		return ret
+	}
+	tenMins := func(i int) db.Bucket {
+		return db.BucketFromTime(t0.Add(time.Duration(i)*10*time.Minute), 10*time.Minute)
+	}
+
+	assert.Equal(t, []graph.RateStats{{Good: 10, Bad: 1, Duration: 10 * time.Minute}}, stats(tenMins(0)))
+	assert.Equal(t, []graph.RateStats{{Good: 20, Bad: 2, Duration: 10 * time.Minute}}, stats(tenMins(1)))
+	assert.Equal(t, []graph.RateStats{{Good: 10, Bad: 1, Duration: 10 * time.Minute}}, stats(tenMins(2)))
+	assert.Empty(t, stats(tenMins(3)))
+
+	hour := db.BucketFromTime(t0, time.Hour)
+	assert.Equal(t, []graph.RateStats{{Good: 40, Bad: 4, Duration: time.Hour}}, stats(hour))
+
+	bt, err := loadBucket(ctx, mdb, hour)
+	jtest.RequireNil(t, err)
+	for _, s := range bt {
+		assert.Equal(t, int64(4), s.Latency.Count())
+	}
+}
+
+func TestCompactCatchesUp(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemDB()
+	t0 := time.Unix(1704110400, 0) // 2024-01-01 12:00 UTC
+
+	c := NewCompactor(mdb, config.Storage{
+		Resolution: time.Minute,
+		Retention:  24 * time.Hour,
+		Rollups: []config.Tier{
+			{Resolution: 10 * time.Minute, Retention: 7 * 24 * time.Hour},
+			{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+		},
+	})
+	c.now = func() time.Time { return t0 }
+	jtest.RequireNil(t, c.Compact(ctx))
+
+	// Traffic every ten minutes for six hours while compaction wasn't running
+	m := api.Metrics{
+		Source: "a", Target: "b", Transport: api.TransportHTTP,
+		Duration: time.Minute, CountGood: 1,
+	}
+	for i := 0; i < 36; i++ {
+		m.Timestamp = t0.Add(time.Duration(i) * 10 * time.Minute).Unix()
+		jtest.RequireNil(t, storeMetrics(ctx, mdb, mdb, time.Minute, []api.Metrics{m}))
+	}
+
+	hourly := func() map[int64]int64 {
+		ret := make(map[int64]int64)
+		for h := 0; h < 6; h++ {
+			bt, err := loadBucket(ctx, mdb, db.BucketFromTime(t0.Add(time.Duration(h)*time.Hour), time.Hour))
+			jtest.RequireNil(t, err)
+			for _, s := range bt {
+				ret[int64(h)] += s.Good
+			}
+		}
+		return ret
+	}
+
+	// Each run catches up on a limited number of buckets, the hourly rollup follows behind,
+	// the hour it has got to is recomputed again on the next run
+	c.now = func() time.Time { return t0.Add(6*time.Hour + 5*time.Minute) }
+	jtest.RequireNil(t, c.Compact(ctx))
+	assert.Equal(t, db.BucketFromTime(t0.Add(290*time.Minute), 10*time.Minute), mdb.Watermarks[10*time.Minute])
+	assert.Equal(t, map[int64]int64{0: 6, 1: 6, 2: 6, 3: 6, 4: 5}, hourly())
+
+	jtest.RequireNil(t, c.Compact(ctx))
+	assert.Equal(t, db.BucketFromTime(t0.Add(6*time.Hour-10*time.Minute), 10*time.Minute), mdb.Watermarks[10*time.Minute])
+	assert.Equal(t, map[int64]int64{0: 6, 1: 6, 2: 6, 3: 6, 4: 6, 5: 6}, hourly())
+}
@@ -5,15 +5,163 @@ import (
 	"flag"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"gopkg.in/yaml.v3"
 )
 
 var configFile = flag.String("config", "", "path to a config yaml")
 
 type Config struct {
-	Groups []Group `yaml:"groups"`
+	Groups  []Group `yaml:"groups"`
+	Auth    Auth    `yaml:"auth"`
+	Limits  Limits  `yaml:"limits"`
+	Storage Storage `yaml:"storage"`
+}
+
+// Storage controls the resolutions traffic is stored at and how long it's kept,
+// zero values use the defaults
+type Storage struct {
+	// Resolution is the duration of the buckets submitted traffic is stored in
+	Resolution time.Duration `yaml:"resolution"`
+	// Retention is how long traffic is kept at Resolution
+	Retention time.Duration `yaml:"retention"`
+	// Rollups are coarser resolutions that traffic is compacted into, in increasing
+	// order of resolution, each must be a multiple of the one before it
+	Rollups []Tier `yaml:"rollups"`
+	// Layout is the version of the redis layout traffic is written in, see db.Layout.
+	// Both layouts are always read, so it can be changed without losing traffic.
+	Layout int `yaml:"layout"`
+}
+
+type Tier struct {
+	Resolution time.Duration `yaml:"resolution"`
+	Retention  time.Duration `yaml:"retention"`
+}
+
+const (
+	DefaultResolution = time.Minute
+	DefaultRetention  = time.Hour
+	DefaultLayout     = 1
+	maxLayout         = 2
+)
+
+var (
+	errResolution     = errors.New("storage resolutions must be whole seconds", j.C("ERR_b4c7c6086f54a2b0"))
+	errRetention      = errors.New("storage retention is shorter than its resolution", j.C("ERR_84df076ca4694706"))
+	errRollupOrder    = errors.New("rollup resolutions must increase", j.C("ERR_ae266d4fffe9ca88"))
+	errRollupMultiple = errors.New("rollup resolution is not a multiple of the previous one", j.C("ERR_ed8076e613e3a4f8"))
+	errLayout         = errors.New("unknown storage layout", j.C("ERR_c7430baa8a368fc1"))
+)
+
+func (s Storage) WithDefaults() Storage {
+	if s.Resolution <= 0 {
+		s.Resolution = DefaultResolution
+	}
+	if s.Retention <= 0 {
+		s.Retention = DefaultRetention
+	}
+	if s.Layout == 0 {
+		s.Layout = DefaultLayout
+	}
+	return s
+}
+
+// Tiers lists every resolution traffic is stored at, finest first
+func (s Storage) Tiers() []Tier {
+	ret := []Tier{{Resolution: s.Resolution, Retention: s.Retention}}
+	return append(ret, s.Rollups...)
+}
+
+// RetentionFor returns how long traffic at the resolution is kept
+func (s Storage) RetentionFor(resolution time.Duration) time.Duration {
+	for _, t := range s.Tiers() {
+		if t.Resolution == resolution {
+			return t.Retention
+		}
+	}
+	return s.Retention
+}
+
+// MaxRetention is the longest that any traffic is kept
+func (s Storage) MaxRetention() time.Duration {
+	var ret time.Duration
+	for _, t := range s.Tiers() {
+		ret = max(ret, t.Retention)
+	}
+	return ret
+}
+
+func (s Storage) validate() error {
+	if s.Layout < 0 || s.Layout > maxLayout {
+		return errors.Wrap(errLayout, "", j.KV("layout", s.Layout))
+	}
+	tiers := s.WithDefaults().Tiers()
+	for i, t := range tiers {
+		kv := j.KV("resolution", t.Resolution)
+		if t.Resolution <= 0 || t.Resolution%time.Second != 0 {
+			return errors.Wrap(errResolution, "", kv)
+		}
+		if t.Retention < t.Resolution {
+			return errors.Wrap(errRetention, "", kv)
+		}
+		if i == 0 {
+			continue
+		}
+		if t.Resolution <= tiers[i-1].Resolution {
+			return errors.Wrap(errRollupOrder, "", kv)
+		}
+		if t.Resolution%tiers[i-1].Resolution != 0 {
+			return errors.Wrap(errRollupMultiple, "", kv)
+		}
+	}
+	return nil
+}
+
+// Limits protects the server from misbehaving clients, zero values use the defaults
+type Limits struct {
+	// MaxBodyBytes is the largest submission accepted, both as sent and once decompressed
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// MaxMetrics is the most metrics accepted in a single submission
+	MaxMetrics int `yaml:"max_metrics"`
+	// SubmitRate limits submissions per second from each credential, or each remote address when auth is disabled, unlimited by default
+	SubmitRate float64 `yaml:"submit_rate"`
+	// SubmitBurst is the number of submissions allowed above SubmitRate
+	SubmitBurst int `yaml:"submit_burst"`
+}
+
+const (
+	DefaultMaxBodyBytes = 8 << 20
+	DefaultMaxMetrics   = 10000
+)
+
+func (l Limits) WithDefaults() Limits {
+	if l.MaxBodyBytes <= 0 {
+		l.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if l.MaxMetrics <= 0 {
+		l.MaxMetrics = DefaultMaxMetrics
+	}
+	if l.SubmitBurst <= 0 {
+		l.SubmitBurst = max(1, int(l.SubmitRate))
+	}
+	return l
+}
+
+// Auth lists the credentials accepted for submitting metrics,
+// submissions are not authenticated when none are configured
+type Auth struct {
+	// BearerTokens are accepted in an "Authorization: Bearer" header
+	BearerTokens []string `yaml:"bearer_tokens"`
+	// HMACKeys are accepted for signing requests, see api.SignSubmission
+	HMACKeys []string `yaml:"hmac_keys"`
+}
+
+func (a Auth) Enabled() bool {
+	return len(a.BearerTokens) > 0 || len(a.HMACKeys) > 0
 }
 
 type Group struct {
@@ -98,10 +246,18 @@ func GetConfig() Config {
 	return config
 }
 
+// SetConfig replaces the loaded config, it's intended for tests
+func SetConfig(c Config) {
+	config = c
+}
+
 func decodeConfig(content []byte) (Config, error) {
 	var c Config
 	d := yaml.NewDecoder(bytes.NewReader(content))
 	d.KnownFields(true)
 	err := d.Decode(&c)
-	return c, err
+	if err != nil {
+		return c, err
+	}
+	return c, c.Storage.validate()
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"io"
 	"testing"
+	"time"
 
+	"github.com/luno/jettison/jtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -35,6 +37,41 @@ groups:
 				}},
 			}},
 		},
+		{
+			name: "auth",
+			yaml: `
+auth:
+  bearer_tokens: ["abc"]
+  hmac_keys: ["def"]
+`,
+			expConfig: Config{Auth: Auth{
+				BearerTokens: []string{"abc"},
+				HMACKeys:     []string{"def"},
+			}},
+		},
+		{
+			name: "storage",
+			yaml: `
+storage:
+  resolution: 1m
+  retention: 24h
+  rollups:
+    - resolution: 10m
+      retention: 168h
+    - resolution: 1h
+      retention: 2160h
+  layout: 2
+`,
+			expConfig: Config{Storage: Storage{
+				Resolution: time.Minute,
+				Retention:  24 * time.Hour,
+				Rollups: []Tier{
+					{Resolution: 10 * time.Minute, Retention: 168 * time.Hour},
+					{Resolution: time.Hour, Retention: 2160 * time.Hour},
+				},
+				Layout: 2,
+			}},
+		},
 		{
 			name: "unknown field",
 			yaml: `
@@ -82,3 +119,39 @@ func TestMatchWildcard(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		storage Storage
+		expErr  error
+	}{
+		{name: "defaults"},
+		{
+			name: "rollups",
+			storage: Storage{Rollups: []Tier{
+				{Resolution: 10 * time.Minute, Retention: 24 * time.Hour},
+				{Resolution: time.Hour, Retention: 24 * time.Hour},
+			}},
+		},
+		{name: "sub second", storage: Storage{Resolution: time.Millisecond}, expErr: errResolution},
+		{name: "short retention", storage: Storage{Retention: time.Second}, expErr: errRetention},
+		{name: "hash layout", storage: Storage{Layout: 2}},
+		{name: "unknown layout", storage: Storage{Layout: 3}, expErr: errLayout},
+		{
+			name:    "decreasing rollup",
+			storage: Storage{Resolution: time.Hour, Retention: 24 * time.Hour, Rollups: []Tier{{Resolution: time.Minute, Retention: time.Hour}}},
+			expErr:  errRollupOrder,
+		},
+		{
+			name:    "rollup not a multiple",
+			storage: Storage{Rollups: []Tier{{Resolution: 90 * time.Second, Retention: time.Hour}}},
+			expErr:  errRollupMultiple,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jtest.Require(t, tc.expErr, tc.storage.validate())
+		})
+	}
+}
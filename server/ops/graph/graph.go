@@ -69,6 +69,7 @@ func stats(m api.Metrics) RateStats {
 		Warning:  m.CountWarning,
 		Bad:      m.CountBad,
 		Duration: m.Duration,
+		Latency:  m.Latency,
 	}
 }
 
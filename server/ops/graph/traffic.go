@@ -1,12 +1,17 @@
 package graph
 
-import "time"
+import (
+	"time"
+
+	"github.com/luno/gridlock/api"
+)
 
 type RateStats struct {
 	Good     int64
 	Warning  int64
 	Bad      int64
 	Duration time.Duration
+	Latency  api.Histogram
 }
 
 func (s RateStats) IsZero() bool {
@@ -23,6 +28,7 @@ func (s RateStats) Sum(o RateStats) RateStats {
 	s.Good += o.Good
 	s.Warning += o.Warning
 	s.Bad += o.Bad
+	s.Latency = s.Latency.Merge(o.Latency)
 	return s
 }
 
@@ -31,6 +37,7 @@ func (s RateStats) Extend(o RateStats) RateStats {
 	s.Warning += o.Warning
 	s.Bad += o.Bad
 	s.Duration += o.Duration
+	s.Latency = s.Latency.Merge(o.Latency)
 	return s
 }
 
@@ -7,6 +7,8 @@ import (
 
 	"github.com/luno/gridlock/api"
 	"github.com/luno/gridlock/server/db"
+	"github.com/luno/gridlock/server/ops/config"
+	"github.com/luno/gridlock/server/ops/graph"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
@@ -15,18 +17,52 @@ import (
 type TrafficStats interface {
 	Record(ctx context.Context, m ...api.Metrics) error
 	GetMetricLog() []api.Metrics
+	// GetMetricLogBetween returns traffic in the range, from the database if it's not in memory
+	GetMetricLogBetween(ctx context.Context, from, to time.Time) ([]api.Metrics, error)
 	GetNodes() []api.NodeInfo
 }
 
+// loadWindow is how much recent traffic the Loader keeps in memory
+const loadWindow = time.Hour
+
+// maxRangeBuckets limits how many buckets a historical query can load,
+// longer ranges are loaded from coarser rollups
+const maxRangeBuckets = 500
+
+// reconcileInterval is how often the Loader reloads the buckets which are still open,
+// to correct for any changes it missed
+const reconcileInterval = time.Minute
+
+var ErrRangeTooLarge = errors.New("time range too large", j.C("ERR_1da2688f7f64a461"))
+
 type Loader struct {
 	trafficDB TrafficDB
 	nodeDB    NodeDB
 
-	now func() time.Time
+	now     func() time.Time
+	storage config.Storage
 
 	mMu     sync.RWMutex
 	metrics []api.Metrics
 	nodes   []api.NodeInfo
+
+	// buckets is the traffic in memory, metrics is compiled from it.
+	// index is the position in metrics of each edge's traffic in a bucket, keys have no Level.
+	// They and nodeCache are only used by WatchKeys.
+	buckets   map[db.Bucket]BucketTraffic
+	index     map[db.TrafficKey]int
+	nodeCache nodeCache
+}
+
+// nodeCache holds the nodes which have been looked up, including the ones which weren't found,
+// so that traffic for a missing node doesn't look it up again until the next reconcile
+type nodeCache struct {
+	found   map[string]api.NodeInfo
+	missing map[string]bool
+}
+
+func newNodeCache() nodeCache {
+	return nodeCache{found: make(map[string]api.NodeInfo), missing: make(map[string]bool)}
 }
 
 func (l *Loader) GetNodes() []api.NodeInfo {
@@ -39,13 +75,18 @@ func (l *Loader) GetNodes() []api.NodeInfo {
 }
 
 func NewLoader(ctx context.Context, trafficDB TrafficDB, nodeDB NodeDB) *Loader {
-	l := &Loader{trafficDB: trafficDB, nodeDB: nodeDB, now: time.Now}
+	l := &Loader{
+		trafficDB: trafficDB,
+		nodeDB:    nodeDB,
+		now:       time.Now,
+		storage:   config.GetConfig().Storage.WithDefaults(),
+	}
 	go l.WatchKeysForever(ctx)
 	return l
 }
 
 func (l *Loader) Record(ctx context.Context, m ...api.Metrics) error {
-	return storeMetrics(ctx, l.trafficDB, l.nodeDB, m)
+	return storeMetrics(ctx, l.trafficDB, l.nodeDB, l.storage.Resolution, m)
 }
 
 func (l *Loader) GetMetricLog() []api.Metrics {
@@ -58,6 +99,49 @@ func (l *Loader) GetMetricLog() []api.Metrics {
 	return ret
 }
 
+func (l *Loader) GetMetricLogBetween(ctx context.Context, from, to time.Time) ([]api.Metrics, error) {
+	if !from.Before(l.now().Add(-loadWindow)) {
+		var ret []api.Metrics
+		for _, m := range l.GetMetricLog() {
+			start := time.Unix(m.Timestamp, 0)
+			if start.Before(to) && start.Add(m.Duration).After(from) {
+				ret = append(ret, m)
+			}
+		}
+		return ret, nil
+	}
+	tier, err := rangeTier(l.storage.Tiers(), l.now(), from, to)
+	if err != nil {
+		return nil, err
+	}
+	buckets := make(map[db.Bucket]BucketTraffic)
+	for _, b := range db.GetBucketsBetween(from, to, tier.Resolution) {
+		bt, err := loadBucket(ctx, l.trafficDB, b)
+		if err != nil {
+			return nil, err
+		}
+		buckets[b] = bt
+	}
+	mLog, _, err := l.compileState(ctx, buckets, newNodeCache())
+	return mLog, err
+}
+
+// rangeTier picks the finest resolution which still has traffic from the start of the range
+// and doesn't need too many buckets to cover it. When none has been kept for long enough
+// the coarsest is used, which has as much as there is.
+func rangeTier(tiers []config.Tier, now, from, to time.Time) (config.Tier, error) {
+	for i, t := range tiers {
+		count := to.Truncate(t.Resolution).Sub(from.Truncate(t.Resolution))/t.Resolution + 1
+		if count > maxRangeBuckets {
+			continue
+		}
+		if now.Sub(from) <= t.Retention || i == len(tiers)-1 {
+			return t, nil
+		}
+	}
+	return config.Tier{}, errors.Wrap(ErrRangeTooLarge, "", j.MKV{"from": from, "to": to})
+}
+
 func (l *Loader) WatchKeysForever(ctx context.Context) {
 	for {
 		err := l.WatchKeys(ctx)
@@ -70,51 +154,155 @@ func (l *Loader) WatchKeysForever(ctx context.Context) {
 	}
 }
 
+// WatchKeys applies changes to the traffic as they're stored,
+// open buckets are reloaded every reconcileInterval in case any were missed
 func (l *Loader) WatchKeys(ctx context.Context) error {
-	fullScan := time.NewTicker(time.Minute)
-	defer fullScan.Stop()
+	reconcile := time.NewTicker(reconcileInterval)
+	defer reconcile.Stop()
 
-	bucketCache := make(map[db.Bucket]BucketTraffic)
+	if err := l.reconcile(ctx); err != nil {
+		return err
+	}
 	for {
-		err := loadTraffic(ctx, l.trafficDB, bucketCache, l.now())
-		if err != nil {
-			return err
+		select {
+		case <-reconcile.C:
+			if err := l.reconcile(ctx); err != nil {
+				return err
+			}
+		case stats := <-l.trafficDB.Changes():
+			if err := l.applyChanges(ctx, stats); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		mLog, nodes, err := l.compileState(ctx, bucketCache)
+	}
+}
+
+// reconcile reloads the open buckets from the database and rebuilds the state
+func (l *Loader) reconcile(ctx context.Context) error {
+	if l.buckets == nil {
+		l.buckets = make(map[db.Bucket]BucketTraffic)
+	}
+	now := l.now()
+	cached := make(map[db.Bucket]bool, len(l.buckets))
+	for b := range l.buckets {
+		cached[b] = true
+	}
+	err := loadTraffic(ctx, l.trafficDB, l.buckets, now, l.storage.Resolution)
+	if err != nil {
+		return err
+	}
+
+	// Changes waiting by now are mostly in what was just loaded, so they're only applied to the
+	// cached closed buckets, which weren't reloaded. This is approximate: ones stored during the load
+	// which are waiting are dropped, and ones stored before it which are still on their way through
+	// pub/sub are applied on top of it, counting them twice. Both are corrected when the bucket is
+	// next reloaded, but the last reload of a bucket before it closes may leave them in place.
+	for drained := false; !drained; {
+		select {
+		case stats := <-l.trafficDB.Changes():
+			for _, s := range stats {
+				if cached[s.Key.Bucket] && !isOpen(s.Key.Bucket, now) {
+					l.cacheStat(s)
+				}
+			}
+		default:
+			drained = true
+		}
+	}
+
+	cache := newNodeCache()
+	mLog, index, err := l.compileState(ctx, l.buckets, cache)
+	if err != nil {
+		return err
+	}
+	l.index, l.nodeCache = index, cache
+	l.setState(mLog, nodeList(cache.found))
+	return nil
+}
+
+// applyChanges adds stats to the traffic in memory, without reloading anything
+func (l *Loader) applyChanges(ctx context.Context, stats []db.TrafficStat) error {
+	if l.buckets == nil {
+		return nil
+	}
+	nodeCount := len(l.nodeCache.found)
+
+	type edgeChange struct {
+		key db.TrafficKey
+		m   api.Metrics
+	}
+	var changes []edgeChange
+	for _, s := range stats {
+		traffic, ok := l.cacheStat(s)
+		if !ok {
+			continue
+		}
+		from, to, ok, err := l.edgeNodes(ctx, s.Key, l.nodeCache)
 		if err != nil {
 			return err
+		} else if !ok {
+			continue
 		}
-		l.setState(mLog, nodes)
+		k := s.Key
+		k.Level = ""
+		changes = append(changes, edgeChange{key: k, m: edgeMetric(k, from, to, traffic[k])})
+	}
 
-		select {
-		case <-fullScan.C:
-		case <-l.trafficDB.WaitForChanges():
-		case <-ctx.Done():
-			return ctx.Err()
+	l.mMu.Lock()
+	defer l.mMu.Unlock()
+	for _, c := range changes {
+		if i, ok := l.index[c.key]; ok {
+			l.metrics[i] = c.m
+			continue
 		}
+		l.index[c.key] = len(l.metrics)
+		l.metrics = append(l.metrics, c.m)
+	}
+	if len(l.nodeCache.found) != nodeCount {
+		l.nodes = nodeList(l.nodeCache.found)
 	}
+	return nil
+}
+
+// cacheStat adds s to its bucket's traffic, or returns false when it isn't kept in memory
+func (l *Loader) cacheStat(s db.TrafficStat) (BucketTraffic, bool) {
+	oldest := db.BucketFromTime(l.now(), l.storage.Resolution).Add(-loadWindow)
+	if s.Key.Bucket.Duration != l.storage.Resolution || s.Key.Bucket.Before(oldest) {
+		return nil, false
+	}
+	traffic, ok := l.buckets[s.Key.Bucket]
+	if !ok {
+		traffic = make(BucketTraffic)
+		l.buckets[s.Key.Bucket] = traffic
+	}
+	traffic.add(s)
+	return traffic, true
 }
 
-func loadTraffic(ctx context.Context, trafficDB TrafficDB, buckets map[db.Bucket]BucketTraffic, now time.Time) error {
+// loadTraffic loads the buckets which the Loader keeps in memory into buckets,
+// closed buckets are kept rather than reloaded and expired ones are removed
+func loadTraffic(ctx context.Context, trafficDB TrafficDB,
+	buckets map[db.Bucket]BucketTraffic, now time.Time, resolution time.Duration,
+) error {
 	for b := range buckets {
-		if now.Sub(b.Time) > time.Hour {
+		if now.Sub(b.Time) > loadWindow {
 			delete(buckets, b)
 		}
 	}
 	t0 := time.Now()
-	last := db.BucketFromTime(now)
+	last := db.BucketFromTime(now, resolution)
 	var count int
-	for _, b := range db.GetBucketsBetween(last.Add(-time.Hour), last.Time) {
-		if _, has := buckets[b]; has && !b.Equal(last.Time) {
+	for _, b := range db.GetBucketsBetween(last.Add(-loadWindow), last.Time, resolution) {
+		if _, has := buckets[b]; has && !isOpen(b, now) {
 			continue
 		}
 		bMetrics, err := loadBucket(ctx, trafficDB, b)
 		if err != nil {
 			return err
 		}
-		if len(bMetrics) > 0 {
-			count++
-		}
+		count++
 		buckets[b] = bMetrics
 	}
 	log.Info(ctx, "loaded metrics from buckets", j.MKV{
@@ -125,60 +313,93 @@ func loadTraffic(ctx context.Context, trafficDB TrafficDB, buckets map[db.Bucket
 	return nil
 }
 
-func (l *Loader) loadNode(ctx context.Context, key string, cache map[string]api.NodeInfo) (api.NodeInfo, error) {
-	if ni, in := cache[key]; in {
+// isOpen is whether traffic may still be being stored in b, buckets are reloaded
+// until they've been closed for a reconcileInterval so the last of it isn't missed
+func isOpen(b db.Bucket, now time.Time) bool {
+	return now.Sub(b.End()) < reconcileInterval
+}
+
+func (l *Loader) loadNode(ctx context.Context, key string, cache nodeCache) (api.NodeInfo, error) {
+	if ni, in := cache.found[key]; in {
 		return ni, nil
+	} else if cache.missing[key] {
+		return api.NodeInfo{}, errors.Wrap(db.ErrNodeNotFound, "")
 	}
 	ni, err := l.nodeDB.GetNode(ctx, key)
-	if err != nil {
+	if errors.Is(err, db.ErrNodeNotFound) {
+		log.Info(ctx, "skipped node", j.KV("node", key))
+		cache.missing[key] = true
+		return api.NodeInfo{}, err
+	} else if err != nil {
 		return api.NodeInfo{}, err
 	}
-	cache[key] = ni
+	cache.found[key] = ni
 	return ni, nil
 }
 
-func (l *Loader) compileState(ctx context.Context, buckets map[db.Bucket]BucketTraffic) ([]api.Metrics, []api.NodeInfo, error) {
-	cache := make(map[string]api.NodeInfo)
+// edgeNodes returns the nodes at each end of the key, or false when either isn't found
+func (l *Loader) edgeNodes(ctx context.Context, k db.TrafficKey, cache nodeCache) (api.NodeInfo, api.NodeInfo, bool, error) {
+	from, err := l.loadNode(ctx, k.FromID, cache)
+	if errors.Is(err, db.ErrNodeNotFound) {
+		return api.NodeInfo{}, api.NodeInfo{}, false, nil
+	} else if err != nil {
+		return api.NodeInfo{}, api.NodeInfo{}, false, err
+	}
+	to, err := l.loadNode(ctx, k.ToID, cache)
+	if errors.Is(err, db.ErrNodeNotFound) {
+		return api.NodeInfo{}, api.NodeInfo{}, false, nil
+	} else if err != nil {
+		return api.NodeInfo{}, api.NodeInfo{}, false, err
+	}
+	return from, to, true, nil
+}
+
+// compileState returns the traffic in buckets, and the position of each key in it
+func (l *Loader) compileState(ctx context.Context,
+	buckets map[db.Bucket]BucketTraffic, cache nodeCache,
+) ([]api.Metrics, map[db.TrafficKey]int, error) {
 	var mLog []api.Metrics
+	index := make(map[db.TrafficKey]int)
 
 	for _, traffic := range buckets {
 		for k, stats := range traffic {
-			from, err := l.loadNode(ctx, k.FromID, cache)
-			if errors.Is(err, db.ErrNodeNotFound) {
-				log.Info(ctx, "skipped node", j.KV("node", k.FromID))
-				continue
-			} else if err != nil {
+			from, to, ok, err := l.edgeNodes(ctx, k, cache)
+			if err != nil {
 				return nil, nil, err
-			}
-			to, err := l.loadNode(ctx, k.ToID, cache)
-			if errors.Is(err, db.ErrNodeNotFound) {
-				log.Info(ctx, "skipped node", j.KV("node", k.ToID))
+			} else if !ok {
 				continue
-			} else if err != nil {
-				return nil, nil, err
 			}
-			mLog = append(mLog, api.Metrics{
-				Source:       from.Name,
-				SourceRegion: from.Region,
-				SourceType:   from.Type,
-				Transport:    api.Transport(k.Transport),
-				Target:       to.Name,
-				TargetRegion: to.Region,
-				TargetType:   to.Type,
-				Timestamp:    k.Bucket.Unix(),
-				Duration:     stats.Duration,
-				CountGood:    stats.Good,
-				CountWarning: stats.Warning,
-				CountBad:     stats.Bad,
-			})
+			index[k] = len(mLog)
+			mLog = append(mLog, edgeMetric(k, from, to, stats))
 		}
 	}
+	return mLog, index, nil
+}
+
+func edgeMetric(k db.TrafficKey, from, to api.NodeInfo, stats graph.RateStats) api.Metrics {
+	return api.Metrics{
+		Source:       from.Name,
+		SourceRegion: from.Region,
+		SourceType:   from.Type,
+		Transport:    api.Transport(k.Transport),
+		Target:       to.Name,
+		TargetRegion: to.Region,
+		TargetType:   to.Type,
+		Timestamp:    k.Bucket.Unix(),
+		Duration:     stats.Duration,
+		CountGood:    stats.Good,
+		CountWarning: stats.Warning,
+		CountBad:     stats.Bad,
+		Latency:      stats.Latency,
+	}
+}
 
+func nodeList(cache map[string]api.NodeInfo) []api.NodeInfo {
 	nodes := make([]api.NodeInfo, 0, len(cache))
 	for _, k := range cache {
 		nodes = append(nodes, k)
 	}
-	return mLog, nodes, nil
+	return nodes
 }
 
 func (l *Loader) setState(log []api.Metrics, nodes []api.NodeInfo) {
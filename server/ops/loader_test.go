@@ -7,8 +7,10 @@ import (
 
 	"github.com/luno/gridlock/api"
 	"github.com/luno/gridlock/server/db"
+	"github.com/luno/gridlock/server/ops/config"
 	"github.com/luno/jettison/jtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoaderMemoryCleanup(t *testing.T) {
@@ -18,7 +20,7 @@ func TestLoaderMemoryCleanup(t *testing.T) {
 
 	ts := time.Now()
 
-	b := db.BucketFromTime(ts)
+	b := db.BucketFromTime(ts, db.DefaultBucketDuration)
 
 	from := api.NodeInfo{
 		Region: "region1",
@@ -31,23 +33,224 @@ func TestLoaderMemoryCleanup(t *testing.T) {
 		Type:   api.NodeService,
 	}
 
-	err := mdb.StoreBucket(ctx, b, []db.TrafficKey{
-		{
+	err := mdb.StoreTraffic(ctx, []db.TrafficStat{
+		{Key: db.TrafficKey{
 			FromID:    db.Key(from).ID(),
 			ToID:      db.Key(to).ID(),
 			Transport: string(api.TransportGRPC),
 			Bucket:    b,
 			Level:     db.Good,
-		},
+		}},
 	})
 	jtest.RequireNil(t, err)
 
-	err = loadTraffic(ctx, mdb, buckets, ts)
+	err = loadTraffic(ctx, mdb, buckets, ts, db.DefaultBucketDuration)
 	jtest.RequireNil(t, err)
 	assert.Len(t, buckets, 61)
 
 	ts = ts.Add(4 * time.Hour)
-	err = loadTraffic(ctx, mdb, buckets, ts)
+	err = loadTraffic(ctx, mdb, buckets, ts, db.DefaultBucketDuration)
 	jtest.RequireNil(t, err)
 	assert.Len(t, buckets, 61)
 }
+
+// testNow is when the loader tests run, 2024-01-01 12:00 UTC
+var testNow = time.Unix(1704110400, 0)
+
+// newTestLoader creates a Loader for mdb with the default storage, whose clock reads now
+func newTestLoader(mdb interface {
+	TrafficDB
+	NodeDB
+}, now *time.Time) *Loader {
+	return &Loader{
+		trafficDB: mdb, nodeDB: mdb,
+		now:     func() time.Time { return *now },
+		storage: config.Storage{}.WithDefaults(),
+	}
+}
+
+func TestLoaderApplyChanges(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemDB()
+	now := testNow
+	l := newTestLoader(mdb, &now)
+	jtest.RequireNil(t, l.reconcile(ctx))
+
+	m := api.Metrics{
+		Source: "a", Target: "b", Transport: api.TransportHTTP,
+		Timestamp: now.Add(-time.Minute).Unix(), Duration: time.Minute,
+		CountGood: 10, Latency: api.Histogram{}.Add(time.Millisecond, 1),
+	}
+	spans := m
+	spans.Target, spans.Duration = "c", 2*time.Minute
+	tooOld := m
+	tooOld.Timestamp = now.Add(-2 * time.Hour).Unix()
+
+	for _, ml := range [][]api.Metrics{{m}, {m, spans}, {tooOld}} {
+		jtest.RequireNil(t, l.Record(ctx, ml...))
+		jtest.RequireNil(t, l.applyChanges(ctx, <-mdb.Changes()))
+	}
+	applied := QueryTraffic(l.GetMetricLog(), TrafficQuery{})
+	assert.Len(t, applied, 3)
+	assert.Len(t, l.GetNodes(), 3)
+
+	// Reconciling loads the same state as the changes built up
+	jtest.RequireNil(t, l.reconcile(ctx))
+	assert.Equal(t, applied, QueryTraffic(l.GetMetricLog(), TrafficQuery{}))
+}
+
+// countingDB counts the buckets and nodes loaded from it
+type countingDB struct {
+	*MemDB
+	loads       int
+	nodeLookups int
+}
+
+func (c *countingDB) GetBucket(ctx context.Context, bucket db.Bucket) ([]db.TrafficStat, error) {
+	c.loads++
+	return c.MemDB.GetBucket(ctx, bucket)
+}
+
+func (c *countingDB) GetNode(ctx context.Context, key string) (api.NodeInfo, error) {
+	c.nodeLookups++
+	return c.MemDB.GetNode(ctx, key)
+}
+
+func TestLoaderReconcileReloadsOpenBuckets(t *testing.T) {
+	ctx := context.Background()
+	mdb := &countingDB{MemDB: NewMemDB()}
+	now := testNow
+	l := newTestLoader(mdb, &now)
+	jtest.RequireNil(t, l.reconcile(ctx))
+	assert.Equal(t, 61, mdb.loads)
+
+	// Changes which are missed are only picked up from open buckets
+	m := api.Metrics{
+		Source: "a", Target: "b", Transport: api.TransportHTTP,
+		Timestamp: now.Unix(), Duration: time.Minute, CountGood: 10,
+	}
+	closed := m
+	closed.Timestamp = now.Add(-30 * time.Minute).Unix()
+	jtest.RequireNil(t, l.Record(ctx, m, closed))
+	<-mdb.Changes()
+
+	mdb.loads = 0
+	jtest.RequireNil(t, l.reconcile(ctx))
+	assert.Equal(t, 2, mdb.loads)
+	traffic := QueryTraffic(l.GetMetricLog(), TrafficQuery{})
+	require.Len(t, traffic, 1)
+	assert.Equal(t, m.Timestamp, traffic[0].Ts)
+
+	// The new bucket and the one which has just closed are reloaded
+	now = now.Add(time.Minute)
+	mdb.loads = 0
+	jtest.RequireNil(t, l.reconcile(ctx))
+	assert.Equal(t, 2, mdb.loads)
+}
+
+func TestLoaderReconcileAppliesWaitingChanges(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemDB()
+	now := testNow
+	l := newTestLoader(mdb, &now)
+	jtest.RequireNil(t, l.reconcile(ctx))
+
+	m := api.Metrics{
+		Source: "a", Target: "b", Transport: api.TransportHTTP,
+		Timestamp: now.Unix(), Duration: time.Minute, CountGood: 10,
+	}
+	closed := m
+	closed.Timestamp = now.Add(-30 * time.Minute).Unix()
+	jtest.RequireNil(t, l.Record(ctx, m, closed))
+
+	// The open bucket's change is already loaded, the closed bucket's isn't reloaded
+	jtest.RequireNil(t, l.reconcile(ctx))
+	traffic := QueryTraffic(l.GetMetricLog(), TrafficQuery{})
+	require.Len(t, traffic, 2)
+	for _, tr := range traffic {
+		assert.Equal(t, int64(10), tr.CountGood)
+	}
+	assert.Empty(t, mdb.Changes())
+}
+
+func TestLoaderCachesMissingNodes(t *testing.T) {
+	ctx := context.Background()
+	mdb := &countingDB{MemDB: NewMemDB()}
+	now := testNow
+	l := newTestLoader(mdb, &now)
+	jtest.RequireNil(t, l.reconcile(ctx))
+
+	stat := db.TrafficStat{
+		Key: db.TrafficKey{
+			FromID: "missing", ToID: "other", Transport: string(api.TransportHTTP),
+			Bucket: db.BucketFromTime(now, time.Minute), Level: db.Good,
+		},
+		Count: 1,
+	}
+	for i := 0; i < 3; i++ {
+		jtest.RequireNil(t, l.applyChanges(ctx, []db.TrafficStat{stat}))
+	}
+	assert.Equal(t, 1, mdb.nodeLookups)
+	assert.Empty(t, l.GetMetricLog())
+
+	// Misses are forgotten when reconciling, in case the node has been registered since
+	jtest.RequireNil(t, mdb.RegisterNode(ctx, "missing", api.NodeInfo{Name: "a"}))
+	jtest.RequireNil(t, mdb.RegisterNode(ctx, "other", api.NodeInfo{Name: "b"}))
+	jtest.RequireNil(t, l.reconcile(ctx))
+	jtest.RequireNil(t, l.applyChanges(ctx, []db.TrafficStat{stat}))
+	assert.Len(t, l.GetMetricLog(), 1)
+}
+
+func TestGetMetricLogBetween(t *testing.T) {
+	ctx := context.Background()
+	mdb := NewMemDB()
+	now := testNow
+
+	storage := config.Storage{
+		Resolution: time.Minute,
+		Retention:  24 * time.Hour,
+		Rollups: []config.Tier{
+			{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+		},
+	}
+	l := newTestLoader(mdb, &now)
+	l.storage = storage
+	c := NewCompactor(mdb, storage)
+
+	m := api.Metrics{
+		Source: "a", Target: "b", Transport: api.TransportHTTP,
+		Duration: time.Minute, CountGood: 10,
+	}
+	// Traffic from yesterday, compacted as it happened
+	for _, ago := range []time.Duration{26 * time.Hour, 25*time.Hour + 30*time.Minute, 2 * time.Hour} {
+		m.Timestamp = now.Add(-ago).Unix()
+		jtest.RequireNil(t, l.Record(ctx, m))
+		c.now = func() time.Time { return now.Add(-ago) }
+		jtest.RequireNil(t, c.Compact(ctx))
+	}
+
+	counts := func(ml []api.Metrics) map[int64]int64 {
+		ret := make(map[int64]int64)
+		for _, m := range ml {
+			ret[m.Timestamp] += m.CountGood
+		}
+		return ret
+	}
+
+	// Within the base retention, loaded a minute at a time
+	ml, err := l.GetMetricLogBetween(ctx, now.Add(-3*time.Hour), now)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, map[int64]int64{now.Add(-2 * time.Hour).Unix(): 10}, counts(ml))
+
+	// Older than the base retention, loaded from the hourly rollup
+	ml, err = l.GetMetricLogBetween(ctx, now.Add(-27*time.Hour), now.Add(-25*time.Hour))
+	jtest.RequireNil(t, err)
+	assert.Equal(t, map[int64]int64{now.Add(-26 * time.Hour).Unix(): 20}, counts(ml))
+	for _, m := range ml {
+		assert.Equal(t, time.Hour, m.Duration)
+	}
+
+	// Too many buckets even for the coarsest resolution
+	_, err = l.GetMetricLogBetween(ctx, now.Add(-1000*time.Hour), now)
+	jtest.Require(t, ErrRangeTooLarge, err)
+}
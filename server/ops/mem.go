@@ -4,6 +4,7 @@ import (
 	"context"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/luno/gridlock/api"
 	"github.com/luno/gridlock/server/db"
@@ -13,67 +14,93 @@ import (
 type MemDB struct {
 	mu      sync.RWMutex
 	Nodes   map[db.TrafficKey]int64
+	Latency map[db.TrafficKey]api.Histogram
 	Buckets map[db.Bucket]map[db.TrafficKey]bool
+	// Watermarks are the rollups' compaction watermarks, by resolution
+	Watermarks map[time.Duration]db.Bucket
 
 	niMu     sync.RWMutex
 	nodeInfo map[string]api.NodeInfo
-	c        chan struct{}
+	changes  chan []db.TrafficStat
 }
 
 func NewMemDB() *MemDB {
 	return &MemDB{
-		Nodes:    make(map[db.TrafficKey]int64),
-		Buckets:  make(map[db.Bucket]map[db.TrafficKey]bool),
-		c:        make(chan struct{}, 1),
-		nodeInfo: make(map[string]api.NodeInfo),
+		Nodes:      make(map[db.TrafficKey]int64),
+		Latency:    make(map[db.TrafficKey]api.Histogram),
+		Buckets:    make(map[db.Bucket]map[db.TrafficKey]bool),
+		Watermarks: make(map[time.Duration]db.Bucket),
+		changes:    make(chan []db.TrafficStat, changesBuffer),
+		nodeInfo:   make(map[string]api.NodeInfo),
 	}
 }
 
-func (m *MemDB) GetTrafficStat(_ context.Context, key db.TrafficKey) (int64, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.Nodes[key], nil
+func (m *MemDB) StoreTraffic(_ context.Context, stats []db.TrafficStat) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range stats {
+		if s.Key.Level == db.Latency {
+			m.Latency[s.Key] = m.Latency[s.Key].Merge(s.Latency)
+		} else {
+			m.Nodes[s.Key] += s.Count
+		}
+		m.addToBucket(s.Key)
+	}
+
+	sendChanges(m.changes, stats)
+	return nil
 }
 
-func (m *MemDB) StoreTrafficStat(_ context.Context, k db.TrafficKey, count int64) error {
+func (m *MemDB) SetTraffic(_ context.Context, stats []db.TrafficStat) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.Nodes[k] = count
-
-	select {
-	case m.c <- struct{}{}:
-	default:
+	for _, s := range stats {
+		if s.Key.Level == db.Latency {
+			m.Latency[s.Key] = s.Latency
+		} else {
+			m.Nodes[s.Key] = s.Count
+		}
+		m.addToBucket(s.Key)
 	}
 	return nil
 }
 
-func (m *MemDB) GetBucket(_ context.Context, bucket db.Bucket) ([]db.TrafficKey, error) {
+func (m *MemDB) GetBucket(_ context.Context, bucket db.Bucket) ([]db.TrafficStat, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	b := m.Buckets[bucket]
-	ret := make([]db.TrafficKey, 0, len(b))
+	ret := make([]db.TrafficStat, 0, len(b))
 	for k := range b {
-		ret = append(ret, k)
+		ret = append(ret, db.TrafficStat{Key: k, Count: m.Nodes[k], Latency: m.Latency[k]})
 	}
 	return ret, nil
 }
 
-func (m *MemDB) StoreBucket(_ context.Context, bucket db.Bucket, keys []db.TrafficKey) error {
+func (m *MemDB) GetWatermark(_ context.Context, resolution time.Duration) (db.Bucket, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.Watermarks[resolution]
+	return b, ok, nil
+}
+
+func (m *MemDB) SetWatermark(_ context.Context, b db.Bucket) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	b, ok := m.Buckets[bucket]
+	m.Watermarks[b.Duration] = b
+	return nil
+}
+
+func (m *MemDB) addToBucket(k db.TrafficKey) {
+	b, ok := m.Buckets[k.Bucket]
 	if !ok {
 		b = make(map[db.TrafficKey]bool)
-		m.Buckets[bucket] = b
+		m.Buckets[k.Bucket] = b
 	}
-	for _, k := range keys {
-		b[k] = true
-	}
-	return nil
+	b[k] = true
 }
 
-func (m *MemDB) WaitForChanges() chan struct{} {
-	return m.c
+func (m *MemDB) Changes() <-chan []db.TrafficStat {
+	return m.changes
 }
 
 func (m *MemDB) RegisterNode(_ context.Context, key string, info api.NodeInfo) error {
@@ -83,6 +110,17 @@ func (m *MemDB) RegisterNode(_ context.Context, key string, info api.NodeInfo) e
 	return nil
 }
 
+func (m *MemDB) RegisterNodes(_ context.Context, nodes map[string]api.NodeInfo) error {
+	m.niMu.Lock()
+	defer m.niMu.Unlock()
+	for key, info := range nodes {
+		if _, ok := m.nodeInfo[key]; !ok {
+			m.nodeInfo[key] = info
+		}
+	}
+	return nil
+}
+
 func (m *MemDB) GetNode(_ context.Context, key string) (api.NodeInfo, error) {
 	m.niMu.RLock()
 	defer m.niMu.RUnlock()
@@ -0,0 +1,33 @@
+package ops
+
+import (
+	"github.com/luno/gridlock/server/db"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var changesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "gridlock",
+	Subsystem: "server",
+	Name:      "changes_dropped_total",
+	Help:      "Batches of traffic changes dropped because the Loader wasn't keeping up, they're picked up when open buckets are reconciled",
+})
+
+var metricsClamped = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "gridlock",
+	Subsystem: "server",
+	Name:      "metrics_clamped_total",
+	Help:      "Metrics whose interval spanned too many buckets and was shortened before storing",
+})
+
+func init() {
+	prometheus.MustRegister(changesDropped, metricsClamped)
+}
+
+// sendChanges passes stats to the Loader without blocking, counting them in changesDropped when c is full
+func sendChanges(c chan<- []db.TrafficStat, stats []db.TrafficStat) {
+	select {
+	case c <- stats:
+	default:
+		changesDropped.Inc()
+	}
+}
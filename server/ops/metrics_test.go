@@ -0,0 +1,21 @@
+package ops
+
+import (
+	"testing"
+
+	"github.com/luno/gridlock/server/db"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendChangesCountsDropped(t *testing.T) {
+	c := make(chan []db.TrafficStat, 1)
+	before := testutil.ToFloat64(changesDropped)
+
+	sendChanges(c, []db.TrafficStat{{Count: 1}})
+	assert.Equal(t, before, testutil.ToFloat64(changesDropped))
+
+	sendChanges(c, []db.TrafficStat{{Count: 2}})
+	assert.Equal(t, before+1, testutil.ToFloat64(changesDropped))
+	assert.Equal(t, []db.TrafficStat{{Count: 1}}, <-c)
+}
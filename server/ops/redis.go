@@ -3,9 +3,13 @@ package ops
 import (
 	"context"
 	"flag"
+	"net"
+	"net/url"
+	"slices"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/luno/gridlock/server/db"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
@@ -15,8 +19,22 @@ var (
 	redisAddr     = flag.String("redis", "redis://127.0.0.1:6379", "Address to connect to the redis server")
 	redisUser     = flag.String("redis_user", "", "User for authentication to the redis server, requires password")
 	redisPassword = flag.String("redis_password", "", "Password for authentication to the redis server")
+	redisPrefix   = flag.String("redis_prefix", "", "Prefix for every redis key and channel, so that the redis server can be shared")
+	redisTraffic  = flag.Int("redis_traffic_db", db.DefaultKeyspace.TrafficDB, "Redis database to store traffic in")
+	redisNodes    = flag.Int("redis_node_db", db.DefaultKeyspace.NodeDB, "Redis database to store nodes in")
+	redisCluster  = flag.Bool("redis_cluster", false, "Connect to a Redis Cluster, the prefix must have a hash tag like {gridlock}")
 )
 
+// RedisKeyspace is where the redis flags say to keep keys
+func RedisKeyspace() db.Keyspace {
+	return db.Keyspace{
+		Prefix:    *redisPrefix,
+		TrafficDB: *redisTraffic,
+		NodeDB:    *redisNodes,
+		Cluster:   *redisCluster,
+	}
+}
+
 func NewRedisPool(ctx context.Context) (*redis.Pool, error) {
 	if *redisAddr == "" {
 		return nil, errors.New("redis not configured")
@@ -38,10 +56,21 @@ func NewRedisPool(ctx context.Context) (*redis.Pool, error) {
 		)
 	}
 
+	ks := RedisKeyspace()
+	if err := ks.Validate(); err != nil {
+		return nil, err
+	}
+	dial := func(ctx context.Context) (redis.Conn, error) {
+		return redis.DialURLContext(ctx, *redisAddr, do...)
+	}
+	if ks.Cluster {
+		dial = func(ctx context.Context) (redis.Conn, error) {
+			return dialSlotOwner(ctx, *redisAddr, db.KeySlot(ks.Prefix), do)
+		}
+	}
+
 	return &redis.Pool{
-		DialContext: func(ctx context.Context) (redis.Conn, error) {
-			return redis.DialURLContext(ctx, *redisAddr, do...)
-		},
+		DialContext: dial,
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
 			if time.Since(t) < time.Minute {
 				return nil
@@ -55,3 +84,41 @@ func NewRedisPool(ctx context.Context) (*redis.Pool, error) {
 		Wait:        true,
 	}, nil
 }
+
+// dialSlotOwner connects to the cluster node which serves slot, every key
+// is in the same slot so commands never need to be redirected to another node.
+// Once the slot moves commands are redirected with MOVED or ASK, which breaks
+// the connection so the pool closes it and the next dial finds the new owner.
+func dialSlotOwner(ctx context.Context, addr string, slot int, do []redis.DialOption) (redis.Conn, error) {
+	seed, err := redis.DialURLContext(ctx, addr, do...)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := db.SlotOwner(ctx, seed, slot)
+	_ = seed.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	host, port, err := net.SplitHostPort(owner)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if host == "" {
+		host = u.Hostname()
+	}
+	// Carry over the options DialURL takes from the address
+	opts := append(slices.Clip(do), redis.DialUseTLS(u.Scheme == "rediss"))
+	if pass, ok := u.User.Password(); ok {
+		opts = append(opts, redis.DialUsername(u.User.Username()), redis.DialPassword(pass))
+	}
+	conn, err := redis.DialContext(ctx, "tcp", net.JoinHostPort(host, port), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.NewClusterConn(conn), nil
+}
@@ -2,26 +2,32 @@ package ops
 
 import (
 	"context"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/luno/gridlock/api"
 	"github.com/luno/gridlock/server/db"
+	"github.com/luno/gridlock/server/ops/config"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/log"
 )
 
 type NodeDB interface {
 	RegisterNode(context.Context, string, api.NodeInfo) error
+	// RegisterNodes stores the nodes by ID which aren't already registered,
+	// and keeps all of them for another ttl
+	RegisterNodes(context.Context, map[string]api.NodeInfo) error
 	GetNode(context.Context, string) (api.NodeInfo, error)
 	GetNodes(context.Context) ([]api.NodeInfo, error)
 }
 
 type RedisNodeDB struct {
 	pool *redis.Pool
+	ks   db.Keyspace
 }
 
-func NewRedisNodeDB(p *redis.Pool) RedisNodeDB {
-	return RedisNodeDB{pool: p}
+func NewRedisNodeDB(p *redis.Pool, ks db.Keyspace) RedisNodeDB {
+	return RedisNodeDB{pool: p, ks: ks}
 }
 
 func (r RedisNodeDB) getConnection(ctx context.Context) (redis.Conn, error) {
@@ -29,7 +35,7 @@ func (r RedisNodeDB) getConnection(ctx context.Context) (redis.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := db.SelectNodeDatabase(c); err != nil {
+	if err := db.SelectNodeDatabase(c, r.ks); err != nil {
 		return nil, err
 	}
 	return c, nil
@@ -49,7 +55,17 @@ func (r RedisNodeDB) RegisterNode(ctx context.Context, key string, n api.NodeInf
 	}
 	defer r.closeConnection(ctx, c)
 
-	return db.StoreNode(ctx, c, key, n)
+	return db.StoreNode(ctx, c, r.ks, key, n, nodeTTL())
+}
+
+func (r RedisNodeDB) RegisterNodes(ctx context.Context, nodes map[string]api.NodeInfo) error {
+	c, err := r.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.closeConnection(ctx, c)
+
+	return db.StoreNodes(ctx, c, r.ks, nodes, nodeTTL())
 }
 
 func (r RedisNodeDB) GetNode(ctx context.Context, key string) (api.NodeInfo, error) {
@@ -59,7 +75,7 @@ func (r RedisNodeDB) GetNode(ctx context.Context, key string) (api.NodeInfo, err
 	}
 	defer r.closeConnection(ctx, c)
 
-	return db.GetNode(ctx, c, key)
+	return db.GetNode(ctx, c, r.ks, key, nodeTTL())
 }
 
 func (r RedisNodeDB) GetNodes(ctx context.Context) ([]api.NodeInfo, error) {
@@ -72,12 +88,12 @@ func (r RedisNodeDB) GetNodes(ctx context.Context) ([]api.NodeInfo, error) {
 	var ret []api.NodeInfo
 	var cursor int64
 	for {
-		keys, next, err := db.GetSomeNodeKeys(ctx, c, cursor)
+		ids, next, err := db.GetSomeNodeIDs(ctx, c, r.ks, cursor)
 		if err != nil {
 			return nil, err
 		}
-		for _, k := range keys {
-			ni, err := db.GetNode(ctx, c, k)
+		for _, id := range ids {
+			ni, err := db.GetNode(ctx, c, r.ks, id, nodeTTL())
 			if errors.Is(err, db.ErrNodeNotFound) {
 				continue
 			} else if err != nil {
@@ -92,3 +108,8 @@ func (r RedisNodeDB) GetNodes(ctx context.Context) ([]api.NodeInfo, error) {
 	}
 	return ret, nil
 }
+
+// nodeTTL keeps nodes for as long as any traffic which refers to them
+func nodeTTL() time.Duration {
+	return max(time.Hour, config.GetConfig().Storage.WithDefaults().MaxRetention())
+}
@@ -2,89 +2,185 @@ package ops
 
 import (
 	"context"
+	"math/bits"
+	"sort"
 	"time"
 
 	"github.com/luno/gridlock/api"
 	"github.com/luno/gridlock/server/db"
-	"github.com/luno/jettison/errors"
 )
 
-func storeMetrics(ctx context.Context, trafficDB TrafficDB, nodeDB NodeDB, metrics []api.Metrics) error {
-	buckets := make(map[db.Bucket][]db.TrafficKey)
+// storeMetrics writes all the metrics' traffic in one batch,
+// after registering every node they refer to in another
+func storeMetrics(ctx context.Context, trafficDB TrafficDB, nodeDB NodeDB,
+	resolution time.Duration, metrics []api.Metrics,
+) error {
+	nodes := make(map[string]api.NodeInfo)
+	var stats []db.TrafficStat
 	for _, m := range metrics {
-		keys, err := storeMetric(ctx, trafficDB, nodeDB, m)
-		if err != nil {
-			return err
+		from := api.NodeInfo{
+			Region: m.SourceRegion,
+			Type:   m.SourceType,
+			Name:   m.Source,
 		}
-		for _, k := range keys {
-			buckets[k.Bucket] = append(buckets[k.Bucket], k)
+		to := api.NodeInfo{
+			Region: m.TargetRegion,
+			Type:   m.TargetType,
+			Name:   m.Target,
 		}
+		nodes[db.Key(from).ID()] = from
+		nodes[db.Key(to).ID()] = to
+		stats = append(stats, metricStats(from, to, resolution, m)...)
 	}
-	for buck, keys := range buckets {
-		err := trafficDB.StoreBucket(ctx, buck, keys)
-		if err != nil {
-			return err
+	if err := nodeDB.RegisterNodes(ctx, nodes); err != nil {
+		return err
+	}
+	return trafficDB.StoreTraffic(ctx, stats)
+}
+
+// metricStats returns the stats to add for a metric, in each bucket it spans
+func metricStats(from, to api.NodeInfo, resolution time.Duration, metric api.Metrics) []db.TrafficStat {
+	var ret []db.TrafficStat
+	for _, share := range splitMetric(metric, resolution) {
+		k := db.TrafficKey{
+			FromID: db.Key(from).ID(), ToID: db.Key(to).ID(),
+			Transport: string(metric.Transport),
+			Bucket:    share.Bucket,
+		}
+		k.Level = db.Good
+		ret = append(ret, db.TrafficStat{Key: k, Count: share.Good})
+		k.Level = db.Warning
+		ret = append(ret, db.TrafficStat{Key: k, Count: share.Warning})
+		k.Level = db.Bad
+		ret = append(ret, db.TrafficStat{Key: k, Count: share.Bad})
+
+		if share.Latency.Count() > 0 {
+			k.Level = db.Latency
+			ret = append(ret, db.TrafficStat{Key: k, Latency: share.Latency})
 		}
 	}
-	return nil
+	return ret
+}
+
+// maxMetricBuckets limits how many buckets a metric is split across,
+// so that a single metric can't make an unbounded number of stats
+const maxMetricBuckets = 60
+
+// metricShare is the part of a metric's counts which falls in a bucket
+type metricShare struct {
+	Bucket  db.Bucket
+	Good    int64
+	Warning int64
+	Bad     int64
+	Latency api.Histogram
 }
 
-func storeMetric(ctx context.Context, trafficDB TrafficDB, nodeDB NodeDB, metric api.Metrics) ([]db.TrafficKey, error) {
-	from := api.NodeInfo{
-		Region: metric.SourceRegion,
-		Type:   metric.SourceType,
-		Name:   metric.Source,
+// splitMetric apportions the counts in m across every bucket of the resolution its interval spans,
+// in proportion to how much of the interval falls in each bucket. Intervals which span more than
+// maxMetricBuckets are clamped to their last maxMetricBuckets, keeping all the counts.
+func splitMetric(m api.Metrics, resolution time.Duration) []metricShare {
+	start := time.Unix(m.Timestamp, 0)
+	end := start.Add(m.Duration)
+	if first := end.Add(-time.Duration(maxMetricBuckets) * resolution); start.Before(first) {
+		start = first
+		metricsClamped.Inc()
 	}
-	if err := maybeStoreNode(ctx, nodeDB, from); err != nil {
-		return nil, err
+
+	var shares []metricShare
+	var weights []time.Duration
+	for _, b := range db.GetBucketsBetween(start, end, resolution) {
+		overlap := minTime(end, b.End()).Sub(maxTime(start, b.Time))
+		if overlap <= 0 {
+			continue
+		}
+		shares = append(shares, metricShare{Bucket: b})
+		weights = append(weights, overlap)
+	}
+	if len(shares) <= 1 {
+		return []metricShare{{
+			Bucket:  db.BucketFromTime(start, resolution),
+			Good:    m.CountGood,
+			Warning: m.CountWarning,
+			Bad:     m.CountBad,
+			Latency: m.Latency,
+		}}
+	}
+
+	for i, n := range apportion(m.CountGood, weights) {
+		shares[i].Good = n
 	}
-	to := api.NodeInfo{
-		Region: metric.TargetRegion,
-		Type:   metric.TargetType,
-		Name:   metric.Target,
+	for i, n := range apportion(m.CountWarning, weights) {
+		shares[i].Warning = n
 	}
-	if err := maybeStoreNode(ctx, nodeDB, to); err != nil {
-		return nil, err
+	for i, n := range apportion(m.CountBad, weights) {
+		shares[i].Bad = n
 	}
+	if len(m.Latency) > 0 {
+		for i := range shares {
+			shares[i].Latency = make(api.Histogram, len(m.Latency))
+		}
+		for idx, count := range m.Latency {
+			for i, n := range apportion(count, weights) {
+				shares[i].Latency[idx] = n
+			}
+		}
+	}
+	return shares
+}
 
-	var ret []db.TrafficKey
-	// TODO(adam): Split metric across buckets based on ts + duration
-	b := db.BucketFromTime(time.Unix(metric.Timestamp, 0))
-	k := db.TrafficKey{
-		FromID: db.Key(from).ID(), ToID: db.Key(to).ID(),
-		Transport: string(metric.Transport),
-		Bucket:    b,
-	}
-	k.Level = db.Good
-	err := trafficDB.StoreTrafficStat(ctx, k, metric.CountGood)
-	if err != nil {
-		return nil, err
-	}
-	ret = append(ret, k)
+// apportion splits n in proportion to weights using the largest remainder method,
+// so that the parts always add up to n
+func apportion(n int64, weights []time.Duration) []int64 {
+	ret := make([]int64, len(weights))
+	if n < 0 {
+		for i, v := range apportion(-n, weights) {
+			ret[i] = -v
+		}
+		return ret
+	}
+	var total uint64
+	for _, w := range weights {
+		total += uint64(w)
+	}
+	if n == 0 || total == 0 {
+		return ret
+	}
 
-	k.Level = db.Warning
-	err = trafficDB.StoreTrafficStat(ctx, k, metric.CountWarning)
-	if err != nil {
-		return nil, err
+	rem := make([]uint64, len(weights))
+	left := n
+	for i, w := range weights {
+		// n*w/total can overflow int64, do it in 128 bits.
+		// The quotient is at most n since w <= total.
+		hi, lo := bits.Mul64(uint64(n), uint64(w))
+		q, r := bits.Div64(hi, lo, total)
+		ret[i] = int64(q)
+		rem[i] = r
+		left -= int64(q)
 	}
-	ret = append(ret, k)
 
-	k.Level = db.Bad
-	err = trafficDB.StoreTrafficStat(ctx, k, metric.CountBad)
-	if err != nil {
-		return nil, err
+	idx := make([]int, len(weights))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return rem[idx[a]] > rem[idx[b]]
+	})
+	for i := int64(0); i < left; i++ {
+		ret[idx[i]]++
 	}
-	ret = append(ret, k)
-	return ret, nil
+	return ret
 }
 
-func maybeStoreNode(ctx context.Context, nodeDB NodeDB, node api.NodeInfo) error {
-	id := db.Key(node).ID()
-	_, err := nodeDB.GetNode(ctx, id)
-	if errors.Is(err, db.ErrNodeNotFound) {
-		return nodeDB.RegisterNode(ctx, id, node)
-	} else if err != nil {
-		return err
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
 	}
-	return nil
+	return b
 }
@@ -0,0 +1,124 @@
+package ops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/gridlock/server/db"
+)
+
+func TestSplitMetric(t *testing.T) {
+	t0 := time.Unix(1704110400, 0) // 2024-01-01 12:00 UTC
+	bucket := func(mins int) db.Bucket {
+		return db.Bucket{Time: t0.Add(time.Duration(mins) * time.Minute), Duration: time.Minute}
+	}
+	testCases := []struct {
+		name      string
+		metric    api.Metrics
+		expShares []metricShare
+	}{
+		{
+			name: "within a bucket",
+			metric: api.Metrics{
+				Timestamp: t0.Add(10 * time.Second).Unix(), Duration: 20 * time.Second,
+				CountGood: 10, CountWarning: 2, CountBad: 1,
+			},
+			expShares: []metricShare{{Bucket: bucket(0), Good: 10, Warning: 2, Bad: 1}},
+		},
+		{
+			name: "no duration",
+			metric: api.Metrics{
+				Timestamp: t0.Add(59 * time.Second).Unix(),
+				CountGood: 10,
+			},
+			expShares: []metricShare{{Bucket: bucket(0), Good: 10}},
+		},
+		{
+			name: "ends on the boundary",
+			metric: api.Metrics{
+				Timestamp: t0.Add(40 * time.Second).Unix(), Duration: 20 * time.Second,
+				CountGood: 10,
+			},
+			expShares: []metricShare{{Bucket: bucket(0), Good: 10}},
+		},
+		{
+			name: "straddles a boundary",
+			metric: api.Metrics{
+				Timestamp: t0.Add(50 * time.Second).Unix(), Duration: 20 * time.Second,
+				CountGood: 10, CountWarning: 1, CountBad: 3,
+			},
+			expShares: []metricShare{
+				{Bucket: bucket(0), Good: 5, Warning: 1, Bad: 2},
+				{Bucket: bucket(1), Good: 5, Bad: 1},
+			},
+		},
+		{
+			name: "spans several buckets",
+			metric: api.Metrics{
+				Timestamp: t0.Add(30 * time.Second).Unix(), Duration: 2 * time.Minute,
+				CountGood: 100,
+				Latency:   api.Histogram{4, 0, 1},
+			},
+			expShares: []metricShare{
+				{Bucket: bucket(0), Good: 25, Latency: api.Histogram{1, 0, 0}},
+				{Bucket: bucket(1), Good: 50, Latency: api.Histogram{2, 0, 1}},
+				{Bucket: bucket(2), Good: 25, Latency: api.Histogram{1, 0, 0}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expShares, splitMetric(tc.metric, time.Minute))
+		})
+	}
+}
+
+func TestSplitMetricClampsLongIntervals(t *testing.T) {
+	t0 := time.Unix(1704110400, 0) // 2024-01-01 12:00 UTC
+	clamped := testutil.ToFloat64(metricsClamped)
+
+	m := api.Metrics{Timestamp: t0.Unix(), Duration: 365 * 24 * time.Hour, CountGood: 6000}
+	shares := splitMetric(m, time.Minute)
+
+	require.Len(t, shares, maxMetricBuckets)
+	end := t0.Add(m.Duration)
+	assert.Equal(t, end.Add(-maxMetricBuckets*time.Minute), shares[0].Bucket.Time)
+	assert.Equal(t, end.Add(-time.Minute), shares[len(shares)-1].Bucket.Time)
+	var total int64
+	for _, s := range shares {
+		total += s.Good
+	}
+	assert.Equal(t, m.CountGood, total)
+	assert.Equal(t, clamped+1, testutil.ToFloat64(metricsClamped))
+}
+
+func TestApportion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		n       int64
+		weights []time.Duration
+		exp     []int64
+	}{
+		{name: "zero", n: 0, weights: []time.Duration{1, 1}, exp: []int64{0, 0}},
+		{name: "even", n: 10, weights: []time.Duration{1, 1}, exp: []int64{5, 5}},
+		{name: "remainder to the largest share", n: 10, weights: []time.Duration{1, 2}, exp: []int64{3, 7}},
+		{name: "ties go to the first", n: 1, weights: []time.Duration{1, 1, 1}, exp: []int64{1, 0, 0}},
+		{name: "negative", n: -10, weights: []time.Duration{1, 2}, exp: []int64{-3, -7}},
+		{
+			name:    "large counts",
+			n:       1 << 50,
+			weights: []time.Duration{time.Hour, time.Hour},
+			exp:     []int64{1 << 49, 1 << 49},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, apportion(tc.n, tc.weights))
+		})
+	}
+}
@@ -5,34 +5,173 @@ import (
 	"time"
 
 	"github.com/luno/gridlock/api"
-	"github.com/luno/gridlock/server/db"
 )
 
+// TrafficFilter selects metrics by their edge, empty fields match anything
+type TrafficFilter struct {
+	Source string
+	Target string
+	// Region matches either end of the edge
+	Region    string
+	Transport api.Transport
+	// Type matches either end of the edge
+	Type api.NodeType
+}
+
+func (f TrafficFilter) Match(m api.Metrics) bool {
+	switch {
+	case f.Source != "" && m.Source != f.Source:
+		return false
+	case f.Target != "" && m.Target != f.Target:
+		return false
+	case f.Region != "" && m.SourceRegion != f.Region && m.TargetRegion != f.Region:
+		return false
+	case f.Transport != "" && m.Transport != f.Transport:
+		return false
+	case f.Type != "" && m.SourceType != f.Type && m.TargetType != f.Type:
+		return false
+	}
+	return true
+}
+
+type TrafficQuery struct {
+	// From and To limit traffic to buckets which overlap the range, zero values are unbounded
+	From, To time.Time
+	Filter   TrafficFilter
+	// Aggregate sums each edge's buckets into a single row covering all of them
+	Aggregate bool
+}
+
+func (q TrafficQuery) include(m api.Metrics) bool {
+	start := time.Unix(m.Timestamp, 0)
+	if !q.From.IsZero() && !start.Add(m.Duration).After(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !start.Before(q.To) {
+		return false
+	}
+	return q.Filter.Match(m)
+}
+
+// SummariseTraffic returns all traffic, or only the bucket containing ts when it's set
 func SummariseTraffic(ml []api.Metrics, ts time.Time) []api.Traffic {
-	var ret []api.Traffic
+	var q TrafficQuery
 	if !ts.IsZero() {
-		ts = db.BucketFromTime(ts).Time
+		q.From, q.To = ts, ts.Add(time.Nanosecond)
 	}
+	return QueryTraffic(ml, q)
+}
+
+func QueryTraffic(ml []api.Metrics, q TrafficQuery) []api.Traffic {
+	var included []api.Metrics
 	for _, m := range ml {
-		buck := time.Unix(m.Timestamp, 0)
-		if !ts.IsZero() && !buck.Equal(ts) {
-			continue
+		if q.include(m) {
+			included = append(included, m)
 		}
+	}
+	if q.Aggregate {
+		included = aggregateEdges(included)
+	}
+
+	var ret []api.Traffic
+	for _, m := range included {
 		ret = append(ret, api.Traffic{
 			From:         m.Source,
 			To:           m.Target,
+			SourceRegion: m.SourceRegion,
+			SourceType:   m.SourceType,
+			TargetRegion: m.TargetRegion,
+			TargetType:   m.TargetType,
+			Transport:    m.Transport,
 			Ts:           m.Timestamp,
-			Duration:     int(db.BucketDuration.Seconds()),
+			Duration:     int(m.Duration.Seconds()),
 			CountGood:    m.CountGood,
 			CountWarning: m.CountWarning,
 			CountBad:     m.CountBad,
+			LatencyP50:   m.Latency.Quantile(0.5).Seconds(),
+			LatencyP99:   m.Latency.Quantile(0.99).Seconds(),
 		})
 	}
-	sort.Slice(ret, func(i, j int) bool {
-		if ret[i].From == ret[j].From {
-			return ret[i].To < ret[j].To
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		switch {
+		case a.From != b.From:
+			return a.From < b.From
+		case a.To != b.To:
+			return a.To < b.To
+		case a.Transport != b.Transport:
+			return a.Transport < b.Transport
+		case a.SourceRegion != b.SourceRegion:
+			return a.SourceRegion < b.SourceRegion
+		case a.TargetRegion != b.TargetRegion:
+			return a.TargetRegion < b.TargetRegion
+		case a.SourceType != b.SourceType:
+			return a.SourceType < b.SourceType
+		case a.TargetType != b.TargetType:
+			return a.TargetType < b.TargetType
+		default:
+			return a.Ts < b.Ts
 		}
-		return ret[i].From < ret[j].From
 	})
 	return ret
 }
+
+type edge struct {
+	Source, SourceRegion string
+	SourceType           api.NodeType
+	Transport            api.Transport
+	Target, TargetRegion string
+	TargetType           api.NodeType
+}
+
+func edgeOf(m api.Metrics) edge {
+	return edge{
+		Source: m.Source, SourceRegion: m.SourceRegion, SourceType: m.SourceType,
+		Transport: m.Transport,
+		Target:    m.Target, TargetRegion: m.TargetRegion, TargetType: m.TargetType,
+	}
+}
+
+// aggregateEdges sums the metrics for each edge, the result spans from the
+// start of the edge's first bucket to the end of its last one
+func aggregateEdges(ml []api.Metrics) []api.Metrics {
+	type sum struct {
+		m          api.Metrics
+		start, end time.Time
+	}
+	sums := make(map[edge]*sum)
+	var order []*sum
+	for _, m := range ml {
+		start := time.Unix(m.Timestamp, 0)
+		end := start.Add(m.Duration)
+
+		e := edgeOf(m)
+		s, ok := sums[e]
+		if !ok {
+			s = &sum{
+				m: api.Metrics{
+					Source: e.Source, SourceRegion: e.SourceRegion, SourceType: e.SourceType,
+					Transport: e.Transport,
+					Target:    e.Target, TargetRegion: e.TargetRegion, TargetType: e.TargetType,
+				},
+				start: start, end: end,
+			}
+			sums[e] = s
+			order = append(order, s)
+		}
+		s.m.CountGood += m.CountGood
+		s.m.CountWarning += m.CountWarning
+		s.m.CountBad += m.CountBad
+		s.m.Latency = s.m.Latency.Merge(m.Latency)
+		s.start = minTime(s.start, start)
+		s.end = maxTime(s.end, end)
+	}
+
+	ret := make([]api.Metrics, 0, len(order))
+	for _, s := range order {
+		s.m.Timestamp = s.start.Unix()
+		s.m.Duration = s.end.Sub(s.start)
+		ret = append(ret, s.m)
+	}
+	return ret
+}
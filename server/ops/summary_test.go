@@ -0,0 +1,98 @@
+package ops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestQueryTraffic(t *testing.T) {
+	t0 := time.Unix(1704110400, 0)
+	metric := func(src, tgt string, trans api.Transport, mins int, good int64) api.Metrics {
+		return api.Metrics{
+			Source: src, SourceRegion: "region-a", SourceType: api.NodeService,
+			Transport: trans,
+			Target:    tgt, TargetRegion: "region-b", TargetType: api.NodeDatabase,
+			Timestamp: t0.Add(time.Duration(mins) * time.Minute).Unix(), Duration: time.Minute,
+			CountGood: good,
+		}
+	}
+	ml := []api.Metrics{
+		metric("a", "b", api.TransportHTTP, 0, 1),
+		metric("a", "b", api.TransportHTTP, 1, 2),
+		metric("a", "b", api.TransportGRPC, 1, 4),
+		metric("b", "c", api.TransportHTTP, 2, 8),
+	}
+	row := func(from, to string, trans api.Transport, mins, dur int, good int64) api.Traffic {
+		return api.Traffic{
+			From: from, SourceRegion: "region-a", SourceType: api.NodeService,
+			Transport: trans,
+			To:        to, TargetRegion: "region-b", TargetType: api.NodeDatabase,
+			Ts: t0.Add(time.Duration(mins) * time.Minute).Unix(), Duration: dur,
+			CountGood: good,
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		query      TrafficQuery
+		expTraffic []api.Traffic
+	}{
+		{
+			name: "everything",
+			expTraffic: []api.Traffic{
+				row("a", "b", api.TransportGRPC, 1, 60, 4),
+				row("a", "b", api.TransportHTTP, 0, 60, 1),
+				row("a", "b", api.TransportHTTP, 1, 60, 2),
+				row("b", "c", api.TransportHTTP, 2, 60, 8),
+			},
+		},
+		{
+			name:  "range",
+			query: TrafficQuery{From: t0.Add(90 * time.Second), To: t0.Add(3 * time.Minute)},
+			expTraffic: []api.Traffic{
+				row("a", "b", api.TransportGRPC, 1, 60, 4),
+				row("a", "b", api.TransportHTTP, 1, 60, 2),
+				row("b", "c", api.TransportHTTP, 2, 60, 8),
+			},
+		},
+		{
+			name:       "source",
+			query:      TrafficQuery{Filter: TrafficFilter{Source: "b"}},
+			expTraffic: []api.Traffic{row("b", "c", api.TransportHTTP, 2, 60, 8)},
+		},
+		{
+			name:       "transport",
+			query:      TrafficQuery{Filter: TrafficFilter{Transport: api.TransportGRPC}},
+			expTraffic: []api.Traffic{row("a", "b", api.TransportGRPC, 1, 60, 4)},
+		},
+		{
+			name:  "region and type match either end",
+			query: TrafficQuery{Filter: TrafficFilter{Region: "region-b", Type: api.NodeService, Target: "c"}},
+			expTraffic: []api.Traffic{
+				row("b", "c", api.TransportHTTP, 2, 60, 8),
+			},
+		},
+		{
+			name:  "aggregate",
+			query: TrafficQuery{Aggregate: true},
+			expTraffic: []api.Traffic{
+				row("a", "b", api.TransportGRPC, 1, 60, 4),
+				row("a", "b", api.TransportHTTP, 0, 120, 3),
+				row("b", "c", api.TransportHTTP, 2, 60, 8),
+			},
+		},
+		{
+			name:  "nothing",
+			query: TrafficQuery{Filter: TrafficFilter{Source: "z"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expTraffic, QueryTraffic(ml, tc.query))
+		})
+	}
+}
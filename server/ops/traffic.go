@@ -2,29 +2,54 @@ package ops
 
 import (
 	"context"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/luno/gridlock/server/db"
+	"github.com/luno/gridlock/server/ops/config"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/log"
 )
 
 type TrafficDB interface {
-	WaitForChanges() chan struct{}
+	// Changes receives the stats stored by StoreTraffic, by any server.
+	// They're dropped and counted in changesDropped when the channel is full, so they can be missed.
+	Changes() <-chan []db.TrafficStat
 
-	GetTrafficStat(ctx context.Context, key db.TrafficKey) (int64, error)
-	StoreTrafficStat(ctx context.Context, k db.TrafficKey, count int64) error
+	// StoreTraffic adds the stats into their keys and adds the keys to their buckets
+	StoreTraffic(ctx context.Context, stats []db.TrafficStat) error
+	// SetTraffic replaces the values in the keys rather than adding to them
+	SetTraffic(ctx context.Context, stats []db.TrafficStat) error
 
-	GetBucket(ctx context.Context, bucket db.Bucket) ([]db.TrafficKey, error)
-	StoreBucket(ctx context.Context, bucket db.Bucket, keys []db.TrafficKey) error
+	// GetBucket returns all the traffic stored in the bucket
+	GetBucket(ctx context.Context, bucket db.Bucket) ([]db.TrafficStat, error)
+
+	// GetWatermark returns the first bucket of the rollup at resolution which may still need compacting,
+	// ok is false when it hasn't been compacted before
+	GetWatermark(ctx context.Context, resolution time.Duration) (b db.Bucket, ok bool, err error)
+	// SetWatermark records that the buckets of b's rollup before b don't need compacting again
+	SetWatermark(ctx context.Context, b db.Bucket) error
 }
 
+const (
+	// changesPing is how often the subscription to changes is checked
+	changesPing = 30 * time.Second
+	// changesBuffer is how many batches of changes are kept until they're received
+	changesBuffer = 100
+)
+
 type RedisTrafficDB struct {
-	Pool *redis.Pool
+	Pool     *redis.Pool
+	Keyspace db.Keyspace
+
+	changes chan []db.TrafficStat
 }
 
-func NewRedisTrafficDB(p *redis.Pool) RedisTrafficDB {
-	return RedisTrafficDB{Pool: p}
+// NewRedisTrafficDB returns a TrafficDB which is notified of traffic stored by any server
+func NewRedisTrafficDB(ctx context.Context, p *redis.Pool, ks db.Keyspace) RedisTrafficDB {
+	r := RedisTrafficDB{Pool: p, Keyspace: ks, changes: make(chan []db.TrafficStat, changesBuffer)}
+	go r.ListenForChangesForever(ctx)
+	return r
 }
 
 func (r RedisTrafficDB) getConnection(ctx context.Context) (redis.Conn, error) {
@@ -32,7 +57,7 @@ func (r RedisTrafficDB) getConnection(ctx context.Context) (redis.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := db.SelectTrafficDatabase(c); err != nil {
+	if err := db.SelectTrafficDatabase(c, r.Keyspace); err != nil {
 		return nil, err
 	}
 	return c, nil
@@ -45,44 +70,141 @@ func (r RedisTrafficDB) closeConnection(ctx context.Context, conn redis.Conn) {
 	}
 }
 
-func (r RedisTrafficDB) WaitForChanges() chan struct{} {
-	return make(chan struct{})
+func (r RedisTrafficDB) Changes() <-chan []db.TrafficStat {
+	return r.changes
 }
 
-func (r RedisTrafficDB) GetTrafficStat(ctx context.Context, key db.TrafficKey) (int64, error) {
+func (r RedisTrafficDB) ListenForChangesForever(ctx context.Context) {
+	for {
+		err := r.ListenForChanges(ctx)
+		if errors.Is(err, context.Canceled) {
+			return
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "listen for changes"))
+		}
+		select {
+		case <-time.After(10 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ListenForChanges subscribes to the keyspace's changes channel and sends the stats in each message to Changes
+func (r RedisTrafficDB) ListenForChanges(ctx context.Context) error {
+	c, err := r.Pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	psc := redis.PubSubConn{Conn: c}
+	defer r.closeConnection(ctx, c)
+
+	if err := psc.Subscribe(r.Keyspace.ChangesChannel()); err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	// Pings stop the connection from timing out, unsubscribing ends the loop below.
+	// The connection isn't closed until they've stopped being sent.
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(changesPing)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				_ = psc.Unsubscribe()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * changesPing).(type) {
+		case redis.Message:
+			stats, err := db.DecodeChanges(v.Data)
+			if err != nil {
+				log.Error(ctx, errors.Wrap(err, "decode changes"))
+				continue
+			}
+			sendChanges(r.changes, stats)
+		case redis.Subscription:
+			if v.Count == 0 {
+				return ctx.Err()
+			}
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(v, "")
+		}
+	}
+}
+
+func (r RedisTrafficDB) StoreTraffic(ctx context.Context, stats []db.TrafficStat) error {
 	c, err := r.getConnection(ctx)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	defer r.closeConnection(ctx, c)
-	return db.GetTrafficStat(ctx, c, key)
+	return db.StoreTraffic(ctx, c, r.Keyspace, layout(), stats, retention)
 }
 
-func (r RedisTrafficDB) StoreTrafficStat(ctx context.Context, k db.TrafficKey, count int64) error {
+func (r RedisTrafficDB) SetTraffic(ctx context.Context, stats []db.TrafficStat) error {
 	c, err := r.getConnection(ctx)
 	if err != nil {
 		return err
 	}
 	defer r.closeConnection(ctx, c)
-	return db.StoreTrafficStat(ctx, c, k, db.DefaultNodeTTL, count)
+	return db.SetTraffic(ctx, c, r.Keyspace, layout(), stats, retention)
 }
 
-func (r RedisTrafficDB) GetBucket(ctx context.Context, bucket db.Bucket) ([]db.TrafficKey, error) {
+func (r RedisTrafficDB) GetBucket(ctx context.Context, bucket db.Bucket) ([]db.TrafficStat, error) {
 	c, err := r.getConnection(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer r.closeConnection(ctx, c)
-	return db.GetBucket(ctx, c, bucket)
+	return db.GetBucket(ctx, c, r.Keyspace, bucket)
+}
+
+func (r RedisTrafficDB) GetWatermark(ctx context.Context, resolution time.Duration) (db.Bucket, bool, error) {
+	c, err := r.getConnection(ctx)
+	if err != nil {
+		return db.Bucket{}, false, err
+	}
+	defer r.closeConnection(ctx, c)
+	return db.GetWatermark(ctx, c, r.Keyspace, resolution)
 }
 
-func (r RedisTrafficDB) StoreBucket(ctx context.Context, bucket db.Bucket, keys []db.TrafficKey) error {
+func (r RedisTrafficDB) SetWatermark(ctx context.Context, b db.Bucket) error {
 	c, err := r.getConnection(ctx)
 	if err != nil {
 		return err
 	}
 	defer r.closeConnection(ctx, c)
-	return db.StoreBucket(ctx, c, bucket, keys, db.DefaultNodeTTL)
+	return db.SetWatermark(ctx, c, r.Keyspace, b)
+}
+
+// retention is how long the bucket's traffic is kept for, according to its resolution
+func retention(b db.Bucket) time.Duration {
+	return config.GetConfig().Storage.WithDefaults().RetentionFor(b.Duration)
+}
+
+// layout is the layout traffic is written in
+func layout() db.Layout {
+	return db.Layout(config.GetConfig().Storage.WithDefaults().Layout)
 }
 
 var _ TrafficDB = (*RedisTrafficDB)(nil)
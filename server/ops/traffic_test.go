@@ -0,0 +1,132 @@
+package ops
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/luno/gridlock/server/db"
+	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePubSub is a redis.Conn which replies to the commands used to subscribe,
+// messages are published to it with publish
+type fakePubSub struct {
+	mu       sync.Mutex
+	channels []string
+	replies  chan interface{}
+}
+
+func newFakePubSub() *fakePubSub {
+	return &fakePubSub{replies: make(chan interface{}, 100)}
+}
+
+func (f *fakePubSub) publish(channel, msg string) {
+	f.replies <- []interface{}{[]byte("message"), []byte(channel), []byte(msg)}
+}
+
+func (f *fakePubSub) subscribed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.channels...)
+}
+
+func (f *fakePubSub) Send(cmd string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(cmd) {
+	case "SUBSCRIBE":
+		for _, a := range args {
+			f.channels = append(f.channels, a.(string))
+			f.replies <- []interface{}{[]byte("subscribe"), []byte(a.(string)), int64(len(f.channels))}
+		}
+	case "UNSUBSCRIBE":
+		for _, c := range f.channels {
+			f.replies <- []interface{}{[]byte("unsubscribe"), []byte(c), int64(0)}
+		}
+		f.channels = nil
+	case "PUNSUBSCRIBE":
+		f.replies <- []interface{}{[]byte("punsubscribe"), nil, int64(0)}
+	case "PING":
+		f.replies <- []interface{}{[]byte("pong"), []byte(args[0].(string))}
+	case "ECHO":
+		f.replies <- args[0]
+	}
+	return nil
+}
+
+func (f *fakePubSub) Receive() (interface{}, error) {
+	return <-f.replies, nil
+}
+
+func (f *fakePubSub) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	select {
+	case r := <-f.replies:
+		return r, nil
+	case <-time.After(timeout):
+		return nil, context.DeadlineExceeded
+	}
+}
+
+func (f *fakePubSub) Do(string, ...interface{}) (interface{}, error) { return nil, nil }
+
+func (f *fakePubSub) DoWithTimeout(time.Duration, string, ...interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (f *fakePubSub) Close() error { return nil }
+func (f *fakePubSub) Err() error   { return nil }
+func (f *fakePubSub) Flush() error { return nil }
+
+func TestListenForChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn := newFakePubSub()
+	ks := db.Keyspace{Prefix: "gl."}
+	r := RedisTrafficDB{
+		Pool:     &redis.Pool{Dial: func() (redis.Conn, error) { return conn, nil }},
+		Keyspace: ks,
+		changes:  make(chan []db.TrafficStat, 1),
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- r.ListenForChanges(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return len(conn.subscribed()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"gl.gridlock.changes"}, conn.subscribed())
+
+	key := db.TrafficKey{FromID: "a", ToID: "b", Transport: "http", Bucket: db.BucketFromTime(time.Unix(1700000040, 0), time.Minute), Level: db.Good}
+
+	// Messages which can't be decoded are skipped
+	conn.publish(ks.ChangesChannel(), "not json")
+	conn.publish(ks.ChangesChannel(), `[{"key":"a.b.http.1700000040.good","count":3}]`)
+	assert.Equal(t, []db.TrafficStat{{Key: key, Count: 3}}, <-r.Changes())
+
+	// Messages are dropped when the changes aren't being received
+	dropped := testutil.ToFloat64(changesDropped)
+	conn.publish(ks.ChangesChannel(), `[{"key":"a.b.http.1700000040.good","count":1}]`)
+	conn.publish(ks.ChangesChannel(), `[{"key":"a.b.http.1700000040.good","count":2}]`)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(changesDropped) == dropped+1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []db.TrafficStat{{Key: key, Count: 1}}, <-r.Changes())
+
+	// Cancelling unsubscribes and stops listening
+	cancel()
+	select {
+	case err := <-errs:
+		jtest.Assert(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("still listening")
+	}
+	assert.Empty(t, conn.subscribed())
+}
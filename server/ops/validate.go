@@ -0,0 +1,76 @@
+package ops
+
+import (
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+var ErrInvalidMetrics = errors.New("invalid metrics", j.C("ERR_2e86bd80a9116060"))
+
+const (
+	// MaxMetricDuration is the longest interval a metric can cover
+	MaxMetricDuration = time.Hour
+	// MaxMetricAge is how long ago a metric's interval can start
+	MaxMetricAge = 24 * time.Hour
+	// MaxClockSkew is how far in the future a metric's interval can start
+	MaxClockSkew = 5 * time.Minute
+)
+
+// ValidateMetrics rejects metrics which would store junk or which aren't from around now,
+// node types and transport may be empty since clients aren't required to set them
+func ValidateMetrics(m api.Metrics, now time.Time) error {
+	ts := time.Unix(m.Timestamp, 0)
+	switch {
+	case m.Source == "":
+		return errors.Wrap(ErrInvalidMetrics, "empty source")
+	case m.Target == "":
+		return errors.Wrap(ErrInvalidMetrics, "empty target")
+	case !validNodeType(m.SourceType):
+		return errors.Wrap(ErrInvalidMetrics, "unknown source type", j.KV("type", m.SourceType))
+	case !validNodeType(m.TargetType):
+		return errors.Wrap(ErrInvalidMetrics, "unknown target type", j.KV("type", m.TargetType))
+	case !validTransport(m.Transport):
+		return errors.Wrap(ErrInvalidMetrics, "unknown transport", j.KV("transport", m.Transport))
+	case m.Duration < 0:
+		return errors.Wrap(ErrInvalidMetrics, "negative duration")
+	case m.Duration > MaxMetricDuration:
+		return errors.Wrap(ErrInvalidMetrics, "duration too long", j.KV("duration", m.Duration))
+	case ts.Before(now.Add(-MaxMetricAge)):
+		return errors.Wrap(ErrInvalidMetrics, "timestamp too old", j.KV("timestamp", m.Timestamp))
+	case ts.After(now.Add(MaxClockSkew)):
+		return errors.Wrap(ErrInvalidMetrics, "timestamp in the future", j.KV("timestamp", m.Timestamp))
+	case m.CountGood < 0 || m.CountWarning < 0 || m.CountBad < 0:
+		return errors.Wrap(ErrInvalidMetrics, "negative count")
+	case len(m.Latency) > api.HistogramBuckets:
+		return errors.Wrap(ErrInvalidMetrics, "too many latency buckets")
+	}
+	for _, n := range m.Latency {
+		if n < 0 {
+			return errors.Wrap(ErrInvalidMetrics, "negative latency count")
+		}
+	}
+	return nil
+}
+
+func validNodeType(t api.NodeType) bool {
+	switch t {
+	case "", api.NodeDatabase, api.NodeInternet, api.NodeService:
+		return true
+	default:
+		return false
+	}
+}
+
+// validTransport only allows the known transports, others could contain
+// the '.' which separates the parts of traffic keys
+func validTransport(t api.Transport) bool {
+	switch t {
+	case "", api.TransportHTTP, api.TransportGRPC, api.TransportSQL:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,68 @@
+package ops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestValidateMetrics(t *testing.T) {
+	now := time.Unix(1704110400, 0) // 2024-01-01 12:00 UTC
+	valid := api.Metrics{
+		Source: "a", SourceType: api.NodeService,
+		Target: "b", Transport: api.TransportHTTP,
+		Timestamp: now.Add(-time.Minute).Unix(),
+		Duration:  time.Minute, CountGood: 1,
+		Latency: api.Histogram{}.Add(time.Millisecond, 1),
+	}
+	testCases := []struct {
+		name   string
+		modify func(m *api.Metrics)
+		expErr error
+	}{
+		{name: "valid", modify: func(*api.Metrics) {}},
+		{name: "empty source", modify: func(m *api.Metrics) { m.Source = "" }, expErr: ErrInvalidMetrics},
+		{name: "empty target", modify: func(m *api.Metrics) { m.Target = "" }, expErr: ErrInvalidMetrics},
+		{name: "unknown type", modify: func(m *api.Metrics) { m.TargetType = "toaster" }, expErr: ErrInvalidMetrics},
+		{name: "unknown transport", modify: func(m *api.Metrics) { m.Transport = "http.2" }, expErr: ErrInvalidMetrics},
+		{name: "no transport", modify: func(m *api.Metrics) { m.Transport = "" }},
+		{name: "negative duration", modify: func(m *api.Metrics) { m.Duration = -time.Second }, expErr: ErrInvalidMetrics},
+		{name: "longest duration", modify: func(m *api.Metrics) { m.Duration = MaxMetricDuration }},
+		{name: "duration too long", modify: func(m *api.Metrics) { m.Duration = MaxMetricDuration + time.Second }, expErr: ErrInvalidMetrics},
+		{
+			name:   "oldest timestamp",
+			modify: func(m *api.Metrics) { m.Timestamp = now.Add(-MaxMetricAge).Unix() },
+		},
+		{
+			name:   "timestamp too old",
+			modify: func(m *api.Metrics) { m.Timestamp = now.Add(-MaxMetricAge - time.Second).Unix() },
+			expErr: ErrInvalidMetrics,
+		},
+		{
+			name:   "skewed timestamp",
+			modify: func(m *api.Metrics) { m.Timestamp = now.Add(MaxClockSkew).Unix() },
+		},
+		{
+			name:   "timestamp in the future",
+			modify: func(m *api.Metrics) { m.Timestamp = now.Add(MaxClockSkew + time.Second).Unix() },
+			expErr: ErrInvalidMetrics,
+		},
+		{name: "negative count", modify: func(m *api.Metrics) { m.CountBad = -1 }, expErr: ErrInvalidMetrics},
+		{name: "negative latency", modify: func(m *api.Metrics) { m.Latency = api.Histogram{-1} }, expErr: ErrInvalidMetrics},
+		{
+			name:   "too many latency buckets",
+			modify: func(m *api.Metrics) { m.Latency = make(api.Histogram, api.HistogramBuckets+1) },
+			expErr: ErrInvalidMetrics,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := valid
+			tc.modify(&m)
+			jtest.Require(t, tc.expErr, ValidateMetrics(m, now))
+		})
+	}
+}
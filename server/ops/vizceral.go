@@ -69,9 +69,10 @@ func compileNode(node graph.Node, tInc graph.TimeInclusionFunc) vizceral.Node {
 		ret.MaxVolume += m.Normal + m.Warning + m.Danger
 		ret.Connections = append(ret.Connections,
 			vizceral.Connection{
-				Source:  t.From,
-				Target:  t.To,
-				Metrics: m,
+				Source:   t.From,
+				Target:   t.To,
+				Metrics:  m,
+				Metadata: latencyMetadata(stats.Latency),
 			},
 		)
 	}
@@ -88,3 +89,20 @@ func CompileVizceralGraph(ml []api.Metrics, from, to time.Time) vizceral.Node {
 	r := graph.Range{From: from, To: to}
 	return compileNode(g, r.Include)
 }
+
+func latencyMetadata(h api.Histogram) map[string]string {
+	if h.Count() == 0 {
+		return nil
+	}
+	return map[string]string{
+		"latency_p50": roundLatency(h.Quantile(0.5)).String(),
+		"latency_p99": roundLatency(h.Quantile(0.99)).String(),
+	}
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
@@ -0,0 +1,168 @@
+package gridlock
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// spool keeps batches which couldn't be submitted as JSON files in a directory,
+// files are named by the time they were written so that they sort oldest first
+type spool struct {
+	dir      string
+	maxAge   time.Duration
+	maxBytes int64
+	now      func() time.Time
+
+	replaying sync.Mutex
+}
+
+type spoolFile struct {
+	Name    string
+	Written time.Time
+	Size    int64
+}
+
+// WithSpool keeps batches which fail to submit in dir and replays them once the server is reachable,
+// batches older than maxAge are discarded along with the oldest batches when dir exceeds maxBytes.
+// A zero maxAge or maxBytes is unlimited.
+func WithSpool(dir string, maxAge time.Duration, maxBytes int64) ClientOption {
+	return func(client *Client) {
+		client.spool = &spool{
+			dir:      dir,
+			maxAge:   maxAge,
+			maxBytes: maxBytes,
+		}
+	}
+}
+
+func (s *spool) Write(sub api.SubmitMetrics) error {
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return errors.Wrap(err, "create spool dir")
+	}
+	f, err := os.CreateTemp(s.dir, strconv.FormatInt(s.now().UnixNano(), 10)+"-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create spool file")
+	}
+	_, err = f.Write(b)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.Wrap(err, "write spool file")
+	}
+	// Only complete files are renamed to be replayed
+	err = os.Rename(f.Name(), strings.TrimSuffix(f.Name(), ".tmp")+".json")
+	if err != nil {
+		return errors.Wrap(err, "rename spool file")
+	}
+	_, err = s.prune()
+	return err
+}
+
+// prune removes expired files and the oldest files over the size limit,
+// returning the remaining files oldest first
+func (s *spool) prune() ([]spoolFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "read spool dir")
+	}
+	var files []spoolFile
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		ts, _, _ := strings.Cut(e.Name(), "-")
+		nanos, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, spoolFile{
+			Name:    filepath.Join(s.dir, e.Name()),
+			Written: time.Unix(0, nanos),
+			Size:    info.Size(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Written.Before(files[j].Written)
+	})
+
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+	now := s.now()
+	for len(files) > 0 {
+		f := files[0]
+		expired := s.maxAge > 0 && now.Sub(f.Written) > s.maxAge
+		tooBig := s.maxBytes > 0 && total > s.maxBytes
+		if !expired && !tooBig {
+			break
+		}
+		if err := os.Remove(f.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrap(err, "remove spool file")
+		}
+		total -= f.Size
+		files = files[1:]
+	}
+	return files, nil
+}
+
+// Replay submits spooled batches oldest first, stopping at the first failure.
+// Files which can't be decoded are logged and removed. Only one replay runs at a time
+// so that batches aren't submitted twice.
+func (s *spool) Replay(ctx context.Context, submit func(api.SubmitMetrics) error) error {
+	if !s.replaying.TryLock() {
+		return nil
+	}
+	defer s.replaying.Unlock()
+
+	files, err := s.prune()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "read spool file")
+		}
+		var sub api.SubmitMetrics
+		if err := json.Unmarshal(b, &sub); err != nil {
+			// Corrupt files will never succeed, don't let them hold up the rest
+			log.Error(ctx, errors.Wrap(err, "decode spool file", j.KV("file", f.Name)))
+			_ = os.Remove(f.Name)
+			continue
+		}
+		if err := submit(sub); err != nil {
+			return err
+		}
+		if err := os.Remove(f.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "remove spool file")
+		}
+	}
+	return nil
+}
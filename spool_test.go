@@ -0,0 +1,145 @@
+package gridlock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luno/gridlock/api"
+)
+
+func TestSpoolPrune(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := &spool{
+		dir:    t.TempDir(),
+		maxAge: time.Hour,
+		now:    func() time.Time { return now },
+	}
+	for i := 0; i < 3; i++ {
+		jtest.RequireNil(t, s.Write(api.SubmitMetrics{Metrics: []api.Metrics{{Source: "a", CountGood: int64(i)}}}))
+		now = now.Add(30 * time.Minute)
+	}
+	// The first has now expired
+	files, err := s.prune()
+	jtest.RequireNil(t, err)
+	require.Len(t, files, 2)
+
+	s.maxBytes = files[1].Size
+	files, err = s.prune()
+	jtest.RequireNil(t, err)
+	require.Len(t, files, 1)
+
+	var sent []int64
+	err = s.Replay(context.Background(), func(sub api.SubmitMetrics) error {
+		sent = append(sent, sub.Metrics[0].CountGood)
+		return nil
+	})
+	jtest.RequireNil(t, err)
+	assert.Equal(t, []int64{2}, sent)
+
+	entries, err := os.ReadDir(s.dir)
+	jtest.RequireNil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSpoolReplayStopsOnError(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := &spool{dir: t.TempDir(), now: func() time.Time { return now }}
+	for i := 0; i < 2; i++ {
+		jtest.RequireNil(t, s.Write(api.SubmitMetrics{Metrics: []api.Metrics{{CountGood: int64(i)}}}))
+		now = now.Add(time.Second)
+	}
+
+	testErr := errors.New("test")
+	var calls int
+	err := s.Replay(context.Background(), func(api.SubmitMetrics) error {
+		calls++
+		return testErr
+	})
+	jtest.Require(t, testErr, err)
+	assert.Equal(t, 1, calls)
+
+	files, err := s.prune()
+	jtest.RequireNil(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestSpoolReplaySkipsCorruptFiles(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := &spool{dir: t.TempDir(), now: func() time.Time { return now }}
+	jtest.RequireNil(t, s.Write(api.SubmitMetrics{Metrics: []api.Metrics{{CountGood: 1}}}))
+	corrupt := filepath.Join(s.dir, strconv.FormatInt(now.Add(-time.Second).UnixNano(), 10)+"-corrupt.json")
+	jtest.RequireNil(t, os.WriteFile(corrupt, []byte("not json"), 0o644))
+
+	var sent []int64
+	err := s.Replay(context.Background(), func(sub api.SubmitMetrics) error {
+		sent = append(sent, sub.Metrics[0].CountGood)
+		return nil
+	})
+	jtest.RequireNil(t, err)
+	assert.Equal(t, []int64{1}, sent)
+
+	entries, err := os.ReadDir(s.dir)
+	jtest.RequireNil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestClientReplaysSpool(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	fail := true
+	var received []api.SubmitMetrics
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		jtest.RequireNil(t, err)
+		var sub api.SubmitMetrics
+		jtest.RequireNil(t, json.Unmarshal(b, &sub))
+		received = append(received, sub)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(
+		WithBaseURL(srv.URL),
+		WithHTTPClient(srv.Client()),
+		WithSpool(t.TempDir(), time.Hour, 0),
+	)
+
+	agg := newAggregate(time.Now())
+	agg.Record(Method{Source: "a", Target: "b"}, CallGood)
+	spooled, err := c.sendBatch(ctx, agg)
+	assert.Error(t, err)
+	assert.True(t, spooled)
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	agg = newAggregate(time.Now())
+	agg.Record(Method{Source: "a", Target: "b"}, CallBad)
+	_, err = c.sendBatch(ctx, agg)
+	jtest.RequireNil(t, err)
+
+	require.Len(t, received, 2)
+	assert.Equal(t, int64(1), received[0].Metrics[0].CountBad)
+	assert.Equal(t, int64(1), received[1].Metrics[0].CountGood)
+}
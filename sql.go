@@ -0,0 +1,319 @@
+package gridlock
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/luno/gridlock/api"
+	"github.com/luno/jettison/errors"
+)
+
+type sqlOptions struct {
+	classify SQLClassifier
+}
+
+type SQLOption func(*sqlOptions)
+
+// WithSQLClassifier overrides DefaultSQLClassifier for reporting query results
+func WithSQLClassifier(f SQLClassifier) SQLOption {
+	return func(o *sqlOptions) {
+		o.classify = f
+	}
+}
+
+type sqlReporter struct {
+	c        *Client
+	m        Method
+	classify SQLClassifier
+}
+
+func newSQLReporter(c *Client, database string, opts []SQLOption) sqlReporter {
+	o := sqlOptions{classify: DefaultSQLClassifier}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return sqlReporter{
+		c: c,
+		m: Method{
+			Target:     database,
+			TargetType: api.NodeDatabase,
+			Transport:  api.TransportSQL,
+		},
+		classify: o.classify,
+	}
+}
+
+func (r sqlReporter) record(t0 time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		// database/sql will retry the query another way
+		return
+	}
+	r.c.RecordDuration(r.m, r.classify(err), time.Since(t0))
+}
+
+// SQLDriverReporter wraps d to record every query and exec against the named database,
+// register the returned driver with sql.Register or use SQLConnectorReporter with sql.OpenDB
+func SQLDriverReporter(c *Client, d driver.Driver, database string, opts ...SQLOption) driver.Driver {
+	return reportingDriver{d: d, r: newSQLReporter(c, database, opts)}
+}
+
+// SQLConnectorReporter wraps conn to record every query and exec against the named database
+func SQLConnectorReporter(c *Client, conn driver.Connector, database string, opts ...SQLOption) driver.Connector {
+	r := newSQLReporter(c, database, opts)
+	return reportingConnector{
+		c: conn,
+		d: reportingDriver{d: conn.Driver(), r: r},
+		r: r,
+	}
+}
+
+type reportingDriver struct {
+	d driver.Driver
+	r sqlReporter
+}
+
+func (d reportingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return reportingConn{c: conn, r: d.r}, nil
+}
+
+func (d reportingDriver) OpenConnector(name string) (driver.Connector, error) {
+	dc, ok := d.d.(driver.DriverContext)
+	if !ok {
+		return reportingConnector{c: dsnConnector{dsn: name, d: d.d}, d: d, r: d.r}, nil
+	}
+	conn, err := dc.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return reportingConnector{c: conn, d: d, r: d.r}, nil
+}
+
+type dsnConnector struct {
+	dsn string
+	d   driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.d.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.d
+}
+
+type reportingConnector struct {
+	c driver.Connector
+	d driver.Driver
+	r sqlReporter
+}
+
+func (c reportingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.c.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return reportingConn{c: conn, r: c.r}, nil
+}
+
+func (c reportingConnector) Driver() driver.Driver {
+	return c.d
+}
+
+type reportingConn struct {
+	c driver.Conn
+	r sqlReporter
+}
+
+func (c reportingConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.c.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return reportingStmt{s: s, r: c.r}, nil
+}
+
+func (c reportingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	pc, ok := c.c.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	s, err := pc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return reportingStmt{s: s, r: c.r}, nil
+}
+
+func (c reportingConn) Close() error {
+	return c.c.Close()
+}
+
+func (c reportingConn) Begin() (driver.Tx, error) {
+	return c.c.Begin()
+}
+
+func (c reportingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	bc, ok := c.c.(driver.ConnBeginTx)
+	if !ok {
+		// Begin can't apply the options, so refuse them like database/sql does for drivers without BeginTx
+		if opts.Isolation != 0 {
+			return nil, errors.New("driver does not support non-default isolation level")
+		}
+		if opts.ReadOnly {
+			return nil, errors.New("driver does not support read-only transactions")
+		}
+		return c.c.Begin()
+	}
+	return bc.BeginTx(ctx, opts)
+}
+
+func (c reportingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.c.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	t0 := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	c.r.record(t0, err)
+	return res, err
+}
+
+func (c reportingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.c.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	t0 := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.r.record(t0, err)
+	return rows, err
+}
+
+func (c reportingConn) Ping(ctx context.Context) error {
+	p, ok := c.c.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	return p.Ping(ctx)
+}
+
+func (c reportingConn) ResetSession(ctx context.Context) error {
+	sr, ok := c.c.(driver.SessionResetter)
+	if !ok {
+		return nil
+	}
+	return sr.ResetSession(ctx)
+}
+
+func (c reportingConn) IsValid() bool {
+	v, ok := c.c.(driver.Validator)
+	if !ok {
+		return true
+	}
+	return v.IsValid()
+}
+
+func (c reportingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	nvc, ok := c.c.(driver.NamedValueChecker)
+	if !ok {
+		return driver.ErrSkip
+	}
+	return nvc.CheckNamedValue(nv)
+}
+
+type reportingStmt struct {
+	s driver.Stmt
+	r sqlReporter
+}
+
+func (s reportingStmt) Close() error {
+	return s.s.Close()
+}
+
+func (s reportingStmt) NumInput() int {
+	return s.s.NumInput()
+}
+
+func (s reportingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	t0 := time.Now()
+	res, err := s.s.Exec(args)
+	s.r.record(t0, err)
+	return res, err
+}
+
+func (s reportingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	t0 := time.Now()
+	rows, err := s.s.Query(args)
+	s.r.record(t0, err)
+	return rows, err
+}
+
+func (s reportingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := s.s.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+	t0 := time.Now()
+	res, err := ec.ExecContext(ctx, args)
+	s.r.record(t0, err)
+	return res, err
+}
+
+func (s reportingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := s.s.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+	t0 := time.Now()
+	rows, err := qc.QueryContext(ctx, args)
+	s.r.record(t0, err)
+	return rows, err
+}
+
+func (s reportingStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	nvc, ok := s.s.(driver.NamedValueChecker)
+	if !ok {
+		return driver.ErrSkip
+	}
+	return nvc.CheckNamedValue(nv)
+}
+
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, 0, len(named))
+	for _, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("driver does not support named parameters")
+		}
+		values = append(values, nv.Value)
+	}
+	return values, nil
+}
+
+var (
+	_ driver.DriverContext      = reportingDriver{}
+	_ driver.Connector          = reportingConnector{}
+	_ driver.ConnPrepareContext = reportingConn{}
+	_ driver.ConnBeginTx        = reportingConn{}
+	_ driver.ExecerContext      = reportingConn{}
+	_ driver.QueryerContext     = reportingConn{}
+	_ driver.Pinger             = reportingConn{}
+	_ driver.SessionResetter    = reportingConn{}
+	_ driver.Validator          = reportingConn{}
+	_ driver.NamedValueChecker  = reportingConn{}
+	_ driver.StmtExecContext    = reportingStmt{}
+	_ driver.StmtQueryContext   = reportingStmt{}
+	_ driver.NamedValueChecker  = reportingStmt{}
+)
@@ -0,0 +1,120 @@
+package gridlock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/luno/gridlock/api"
+)
+
+type fakeDriver struct {
+	err error
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return fakeConn(d), nil
+}
+
+// fakeConn doesn't implement ExecerContext so that exec goes via a prepared statement
+type fakeConn struct {
+	err error
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt(c), nil }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c fakeConn) QueryContext(_ context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return fakeRows{}, nil
+}
+
+type fakeStmt struct {
+	err error
+}
+
+func (s fakeStmt) Close() error                               { return nil }
+func (s fakeStmt) NumInput() int                              { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), s.err }
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return fakeRows{}, s.err }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return nil }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+func TestSQLDriverReporter(t *testing.T) {
+	c := queuedClient(WithDefaultMethod(Method{Source: "service"}))
+	conn, err := SQLDriverReporter(c, fakeDriver{}, "service_db").(driver.DriverContext).OpenConnector("")
+	require.NoError(t, err)
+	dbc := sql.OpenDB(conn)
+	t.Cleanup(func() { _ = dbc.Close() })
+
+	ctx := context.Background()
+	_, err = dbc.ExecContext(ctx, "update")
+	require.NoError(t, err)
+
+	rows, err := dbc.QueryContext(ctx, "select")
+	require.NoError(t, err)
+	_ = rows.Close()
+
+	exp := Method{
+		Source:     "service",
+		Target:     "service_db",
+		TargetType: api.NodeDatabase,
+		Transport:  api.TransportSQL,
+	}
+	for _, s := range []CallSuccess{CallGood, CallGood} {
+		call := <-c.q
+		assert.Equal(t, exp, call.M)
+		assert.Equal(t, s, call.Success)
+	}
+}
+
+func TestSQLConnectorReporterErrors(t *testing.T) {
+	c := queuedClient()
+	conn := dsnConnector{d: fakeDriver{err: errors.New("syntax error")}}
+	dbc := sql.OpenDB(SQLConnectorReporter(c, conn, "db"))
+	t.Cleanup(func() { _ = dbc.Close() })
+
+	_, err := dbc.ExecContext(context.Background(), "update")
+	require.Error(t, err)
+
+	call := <-c.q
+	assert.Equal(t, "db", call.M.Target)
+	assert.Equal(t, CallBad, call.Success)
+}
+
+func TestSQLBeginTxOptions(t *testing.T) {
+	conn := dsnConnector{d: fakeDriver{}}
+	dbc := sql.OpenDB(SQLConnectorReporter(NewClient(), conn, "db"))
+	t.Cleanup(func() { _ = dbc.Close() })
+
+	ctx := context.Background()
+	_, err := dbc.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	require.ErrorContains(t, err, "read-only")
+
+	_, err = dbc.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	require.ErrorContains(t, err, "isolation level")
+
+	// Without options the driver's Begin is used
+	_, err = dbc.BeginTx(ctx, nil)
+	require.ErrorIs(t, err, driver.ErrSkip)
+}
+
+func TestDefaultSQLClassifier(t *testing.T) {
+	assert.Equal(t, CallGood, DefaultSQLClassifier(nil))
+	assert.Equal(t, CallWarning, DefaultSQLClassifier(context.Canceled))
+	assert.Equal(t, CallBad, DefaultSQLClassifier(context.DeadlineExceeded))
+	assert.Equal(t, CallBad, DefaultSQLClassifier(driver.ErrBadConn))
+}
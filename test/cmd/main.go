@@ -15,18 +15,6 @@ import (
 	"github.com/luno/jettison/log"
 )
 
-func deliverForever(ctx context.Context, c *gridlock.Client) {
-	for {
-		err := c.Deliver(ctx)
-		if errors.IsAny(err, context.Canceled) {
-			return
-		} else if err != nil {
-			log.Error(ctx, err)
-		}
-		time.Sleep(time.Second)
-	}
-}
-
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -34,13 +22,17 @@ func main() {
 	c := gridlock.NewClient(
 		gridlock.WithBaseURL("http://localhost/gridlock"),
 		gridlock.WithFlushPeriod(time.Second),
+		gridlock.WithNonFatalDelivery(time.Second, time.Minute),
 	)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		deliverForever(ctx, c)
+		err := c.Deliver(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Error(ctx, err)
+		}
 	}()
 
 	for i := 0; i < 5; i++ {